@@ -41,10 +41,13 @@ func cliHandleError(err error) {
 }
 
 func cliResponse(objs []types.APIObject) {
-	resp := types.APIResponse{
+	cliSendResponse(types.APIResponse{
 		Success: true,
 		Objects: objs,
-	}
+	})
+}
+
+func cliSendResponse(resp types.APIResponse) {
 	respJSON, _ := json.MarshalIndent(resp, "", "  ")
 	fmt.Println(string(respJSON))
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/store"
+	"gitlab.com/contextualcode/go-object-store/types"
+
+	"github.com/spf13/cobra"
+)
+
+var groupSubCmd = &cobra.Command{
+	Use:   "group",
+	Short: "User group commands.",
+}
+
+var groupShowCmd = &cobra.Command{
+	Use:   "show name",
+	Short: "Show the effective permissions of a user group including those it inherits.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cliHandleError(errors.WithStack(store.ErrInvalidArg))
+		}
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// resolve
+		group, err := client.EffectiveUserGroup(args[0])
+		cliHandleError(err)
+		cliResponse([]types.APIObject{group.API()})
+	},
+}
+
+var groupCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the user groups for invalid rules and inheritance cycles.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// check
+		cliHandleError(client.CheckUserGroups())
+		cliResponse([]types.APIObject{})
+	},
+}
+
+var groupListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the configured and stored user groups.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// list
+		userGroups, err := client.UserGroups(nil)
+		cliHandleError(err)
+		out := make([]types.APIObject, 0)
+		for _, userGroup := range userGroups {
+			out = append(out, userGroup.API())
+		}
+		cliResponse(out)
+	},
+}
+
+var groupSetCmd = &cobra.Command{
+	Use:     "set name permissions",
+	Aliases: []string{"create", "update"},
+	Short:   "Create or replace a stored user group from its JSON permissions, i.e. '{\"inherits\": [\"staff\"], \"get\": true}'.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cliHandleError(errors.WithStack(store.ErrInvalidArg))
+		}
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// parse permissions
+		o := make(types.APIObject)
+		if err := json.Unmarshal([]byte(args[1]), &o); err != nil {
+			cliHandleError(errors.Wrap(store.ErrInvalidArg, err.Error()))
+		}
+		o["name"] = args[0]
+		userGroup, err := store.ParseUserGroup(o)
+		cliHandleError(err)
+		// store
+		cliHandleError(client.SetUserGroup(userGroup.Name, userGroup.UserGroup, nil))
+		cliResponse([]types.APIObject{userGroup.API()})
+	},
+}
+
+var groupDeleteCmd = &cobra.Command{
+	Use:     "delete name",
+	Aliases: []string{"del", "rm"},
+	Short:   "Delete a stored user group.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cliHandleError(errors.WithStack(store.ErrInvalidArg))
+		}
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// delete
+		cliHandleError(client.DeleteUserGroup(args[0], nil))
+		cliResponse([]types.APIObject{})
+	},
+}
+
+func init() {
+	groupSubCmd.AddCommand(groupListCmd)
+	groupSubCmd.AddCommand(groupSetCmd)
+	groupSubCmd.AddCommand(groupDeleteCmd)
+	groupSubCmd.AddCommand(groupShowCmd)
+	groupSubCmd.AddCommand(groupCheckCmd)
+	rootCmd.AddCommand(groupSubCmd)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"gitlab.com/contextualcode/go-object-store/store"
+	"gitlab.com/contextualcode/go-object-store/types"
+
+	"github.com/spf13/cobra"
+)
+
+var indexSubCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Index commands.",
+}
+
+var indexRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Regenerate the index from the stored objects.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// rebuild
+		count, err := client.RebuildIndex()
+		cliHandleError(err)
+		cliResponse([]types.APIObject{{"indexed": count}})
+	},
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck [--repair]",
+	Short: "Check the store for inconsistencies.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// check
+		repair := cmd.Flags().Lookup("repair").Value.String() == "true"
+		issues, err := client.Fsck(repair)
+		cliHandleError(err)
+		out := make([]types.APIObject, 0)
+		for _, issue := range issues {
+			out = append(out, issue.API())
+		}
+		cliResponse(out)
+	},
+}
+
+func init() {
+	fsckCmd.Flags().Bool("repair", false, "Repair the issues found.")
+	indexSubCmd.AddCommand(indexRebuildCmd)
+	rootCmd.AddCommand(indexSubCmd)
+	rootCmd.AddCommand(fsckCmd)
+}
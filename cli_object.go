@@ -156,9 +156,146 @@ var objGetCmd = &cobra.Command{
 	},
 }
 
+var objShareCmd = &cobra.Command{
+	Use:   "share principal [--perm]",
+	Short: "Share objects with a user, 'user:<username>', or a group, 'group:<name>'. Without --perm the objects are unshared.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// get user to share as
+		user, err := getUserFromObjectCommand(client)
+		cliHandleError(err)
+		// get uids
+		uids := getObjectUidsFromCommand()
+		if len(uids) == 0 {
+			cliHandleError(store.ErrMissingUID)
+		}
+		// users are given by username or uid
+		principal := args[0]
+		if strings.HasPrefix(principal, types.ACLUserPrefix) {
+			shareUser, err := client.GetUserByUsername(strings.TrimPrefix(principal, types.ACLUserPrefix))
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				cliHandleError(err)
+			}
+			if shareUser != nil {
+				principal = types.ACLUserPrefix + shareUser.UID
+			}
+		}
+		perms := cmd.Flags().Lookup("perm").Value.(pflag.SliceValue).GetSlice()
+		out := make([]types.APIObject, 0)
+		for _, uid := range uids {
+			obj, err := client.Share(uid, principal, perms, user)
+			cliHandleError(err)
+			out = append(out, obj.API())
+		}
+		cliHandleError(client.Sync())
+		cliResponse(out)
+	},
+}
+
 var objQueryCmd = &cobra.Command{
-	Use:   "query",
+	Use:   "query [--filter] [--sort] [--limit] [--cursor] [--total] [--full] [--fields] [--explain]",
 	Short: "Run a query.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// get user to set as
+		user, err := getUserFromObjectCommand(client)
+		cliHandleError(err)
+		// get query string or filter document
+		query := strings.Join(args, " ")
+		var filter types.Filter
+		if rawFilter := cmd.Flags().Lookup("filter").Value.String(); rawFilter != "" {
+			cliHandleError(json.Unmarshal([]byte(rawFilter), &filter))
+		}
+		if (query == "") == (filter == nil) {
+			cliHandleError(store.ErrInvalidArg)
+		}
+		// get query options
+		opts := types.QueryOptions{
+			Sort:    cmd.Flags().Lookup("sort").Value.(pflag.SliceValue).GetSlice(),
+			Cursor:  cmd.Flags().Lookup("cursor").Value.String(),
+			Total:   cmd.Flags().Lookup("total").Value.String() == "true",
+			Full:    cmd.Flags().Lookup("full").Value.String() == "true",
+			Fields:  cmd.Flags().Lookup("fields").Value.(pflag.SliceValue).GetSlice(),
+			Explain: cmd.Flags().Lookup("explain").Value.String() == "true",
+		}
+		opts.Limit, err = cmd.Flags().GetInt("limit")
+		cliHandleError(err)
+		// perform query
+		cliHandleError(client.Sync())
+		var res *store.QueryResult
+		if filter != nil {
+			res, err = client.QueryFilter(filter, opts, user)
+		} else {
+			res, err = client.QueryWithOptions(query, opts, user)
+		}
+		cliHandleError(err)
+		resp := types.APIResponse{
+			Success: true,
+			Objects: res.API(),
+			Cursor:  res.Cursor,
+		}
+		if opts.Total {
+			resp.Total = &res.Total
+		}
+		if res.Explain != nil {
+			resp.Explain = res.Explain.API()
+		}
+		cliSendResponse(resp)
+	},
+}
+
+var objSearchCmd = &cobra.Command{
+	Use:   "search [-q query] [--limit] [--cursor] [--total] [--full] [--fields]",
+	Short: "Run a full-text search.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// get user to set as
+		user, err := getUserFromObjectCommand(client)
+		cliHandleError(err)
+		// get search text
+		text := strings.Join(args, " ")
+		if text == "" {
+			cliHandleError(store.ErrInvalidArg)
+		}
+		// get query options
+		query := cmd.Flags().Lookup("query").Value.String()
+		opts := types.QueryOptions{
+			Cursor: cmd.Flags().Lookup("cursor").Value.String(),
+			Total:  cmd.Flags().Lookup("total").Value.String() == "true",
+			Full:   cmd.Flags().Lookup("full").Value.String() == "true",
+			Fields: cmd.Flags().Lookup("fields").Value.(pflag.SliceValue).GetSlice(),
+		}
+		opts.Limit, err = cmd.Flags().GetInt("limit")
+		cliHandleError(err)
+		// perform search
+		res, err := client.Search(text, query, opts, user)
+		cliHandleError(err)
+		resp := types.APIResponse{
+			Success: true,
+			Objects: res.API(),
+			Cursor:  res.Cursor,
+		}
+		if opts.Total {
+			resp.Total = &res.Total
+		}
+		cliSendResponse(resp)
+	},
+}
+
+var objAggregateCmd = &cobra.Command{
+	Use:     "aggregate [--group-by] [--agg]",
+	Aliases: []string{"agg"},
+	Short:   "Compute aggregates over a query.",
 	Run: func(cmd *cobra.Command, args []string) {
 		// get config + store
 		config, err := loadConfigFromCommand()
@@ -172,16 +309,60 @@ var objQueryCmd = &cobra.Command{
 		if query == "" {
 			cliHandleError(store.ErrInvalidArg)
 		}
+		groupBy := cmd.Flags().Lookup("group-by").Value.(pflag.SliceValue).GetSlice()
+		aggregates := cmd.Flags().Lookup("agg").Value.(pflag.SliceValue).GetSlice()
+		// perform aggregate
+		cliHandleError(client.Sync())
+		out, err := client.Aggregate(query, groupBy, aggregates, user)
+		cliHandleError(err)
+		cliResponse(out)
+	},
+}
+
+var objSavedQueryCmd = &cobra.Command{
+	Use:   "saved-query name [--param] [--sort] [--limit] [--cursor] [--total] [--full] [--fields]",
+	Short: "Run a saved query.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		// get user to set as
+		user, err := getUserFromObjectCommand(client)
+		cliHandleError(err)
+		// get parameters, given as 'name=value'
+		params := make(map[string]interface{})
+		for _, param := range cmd.Flags().Lookup("param").Value.(pflag.SliceValue).GetSlice() {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				cliHandleError(store.ErrInvalidArg)
+			}
+			params[kv[0]] = kv[1]
+		}
+		// get query options
+		opts := types.QueryOptions{
+			Sort:   cmd.Flags().Lookup("sort").Value.(pflag.SliceValue).GetSlice(),
+			Cursor: cmd.Flags().Lookup("cursor").Value.String(),
+			Total:  cmd.Flags().Lookup("total").Value.String() == "true",
+			Full:   cmd.Flags().Lookup("full").Value.String() == "true",
+			Fields: cmd.Flags().Lookup("fields").Value.(pflag.SliceValue).GetSlice(),
+		}
+		opts.Limit, err = cmd.Flags().GetInt("limit")
+		cliHandleError(err)
 		// perform query
 		cliHandleError(client.Sync())
-		res, err := client.Query(query, user)
+		res, err := client.SavedQuery(args[0], params, opts, user)
 		cliHandleError(err)
-		// get object
-		out := make([]types.APIObject, 0)
-		for _, obj := range res {
-			out = append(out, obj.API())
+		resp := types.APIResponse{
+			Success: true,
+			Objects: res.API(),
+			Cursor:  res.Cursor,
 		}
-		cliResponse(out)
+		if opts.Total {
+			resp.Total = &res.Total
+		}
+		cliSendResponse(resp)
 	},
 }
 
@@ -189,8 +370,36 @@ func init() {
 	objSubCmd.PersistentFlags().StringArrayP("uid", "u", []string{}, "UID of object.")
 	objSubCmd.PersistentFlags().String("user", "", "User to access object as.")
 	objSetCmd.Flags().String("data", "", "JSON object data.")
+	objQueryCmd.Flags().String("filter", "", "JSON filter document to query by instead of a query string.")
+	objQueryCmd.Flags().StringArray("sort", []string{}, "Field to order by, prefix with '-' for descending order.")
+	objQueryCmd.Flags().Int("limit", 0, "Max number of objects to return.")
+	objQueryCmd.Flags().String("cursor", "", "Cursor of the page to return.")
+	objQueryCmd.Flags().Bool("total", false, "Include the total number of matches.")
+	objQueryCmd.Flags().Bool("full", false, "Return full stored objects.")
+	objQueryCmd.Flags().StringArray("fields", []string{}, "Only return given fields.")
+	objQueryCmd.Flags().Bool("explain", false, "Describe how the query was evaluated.")
 	objSubCmd.AddCommand(objSetCmd)
 	objSubCmd.AddCommand(objDeleteCmd)
 	objSubCmd.AddCommand(objGetCmd)
+	objShareCmd.Flags().StringArray("perm", []string{}, "Permission to grant, one of get, update or delete.")
+	objSubCmd.AddCommand(objShareCmd)
+	objAggregateCmd.Flags().StringArray("group-by", []string{}, "Field to group by.")
+	objAggregateCmd.Flags().StringArray("agg", []string{}, "Aggregate function, i.e. 'count' or 'sum(views)'.")
 	objSubCmd.AddCommand(objQueryCmd)
+	objSearchCmd.Flags().StringP("query", "q", "", "Query to filter search results by.")
+	objSearchCmd.Flags().Int("limit", 0, "Max number of objects to return.")
+	objSearchCmd.Flags().String("cursor", "", "Cursor of the page to return.")
+	objSearchCmd.Flags().Bool("total", false, "Include the total number of matches.")
+	objSearchCmd.Flags().Bool("full", false, "Return full stored objects.")
+	objSearchCmd.Flags().StringArray("fields", []string{}, "Only return given fields.")
+	objSubCmd.AddCommand(objAggregateCmd)
+	objSubCmd.AddCommand(objSearchCmd)
+	objSavedQueryCmd.Flags().StringArray("param", []string{}, "Query parameter as 'name=value'.")
+	objSavedQueryCmd.Flags().StringArray("sort", []string{}, "Field to order by, prefix with '-' for descending order.")
+	objSavedQueryCmd.Flags().Int("limit", 0, "Max number of objects to return.")
+	objSavedQueryCmd.Flags().String("cursor", "", "Cursor of the page to return.")
+	objSavedQueryCmd.Flags().Bool("total", false, "Include the total number of matches.")
+	objSavedQueryCmd.Flags().Bool("full", false, "Return full stored objects.")
+	objSavedQueryCmd.Flags().StringArray("fields", []string{}, "Only return given fields.")
+	objSubCmd.AddCommand(objSavedQueryCmd)
 }
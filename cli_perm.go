@@ -0,0 +1,44 @@
+package main
+
+import (
+	"gitlab.com/contextualcode/go-object-store/store"
+	"gitlab.com/contextualcode/go-object-store/types"
+
+	"github.com/spf13/cobra"
+)
+
+var permSubCmd = &cobra.Command{
+	Use:   "perm",
+	Short: "Permission commands.",
+}
+
+var permCheckCmd = &cobra.Command{
+	Use:   "check --user user --uid uid --action action",
+	Short: "Explain whether a user, by username or uid, may get, list (query), set, update or delete an object.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// get config + store
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		cliHandleError(client.LoadUserGroups())
+		// check
+		user, err := client.FindUser(cmd.Flags().Lookup("user").Value.String())
+		cliHandleError(err)
+		explain, err := client.ExplainPermission(
+			cmd.Flags().Lookup("action").Value.String(),
+			cmd.Flags().Lookup("uid").Value.String(),
+			user,
+			nil,
+		)
+		cliHandleError(err)
+		cliResponse([]types.APIObject{explain.API()})
+	},
+}
+
+func init() {
+	permCheckCmd.Flags().String("user", "", "Username or uid of the user to check.")
+	permCheckCmd.Flags().String("uid", "", "Uid of the object to check.")
+	permCheckCmd.Flags().String("action", "get", "Permission to check, get, list, set, update or delete.")
+	permSubCmd.AddCommand(permCheckCmd)
+	rootCmd.AddCommand(permSubCmd)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/pkg/errors"
 	"gitlab.com/contextualcode/go-object-store/store"
 	"gitlab.com/contextualcode/go-object-store/types"
@@ -81,6 +84,25 @@ var userSetCmd = &cobra.Command{
 			cliHandleError(err)
 		}
 		user.Groups = groups
+		// attributes are given as 'name=value', values are decoded as JSON when valid and an empty value removes the attribute
+		for _, attr := range cmd.Flags().Lookup("attr").Value.(pflag.SliceValue).GetSlice() {
+			parts := strings.SplitN(attr, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				cliHandleError(store.ErrInvalidArg)
+			}
+			if user.Attributes == nil {
+				user.Attributes = make(map[string]interface{})
+			}
+			if parts[1] == "" {
+				delete(user.Attributes, parts[0])
+				continue
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(parts[1]), &value); err != nil {
+				value = parts[1]
+			}
+			user.Attributes[parts[0]] = value
+		}
 		user.Active = disable == "false"
 		// store user
 		if err := client.SetUser(user); err != nil {
@@ -117,6 +139,21 @@ var userDeleteCmd = &cobra.Command{
 	},
 }
 
+var userUsageCmd = &cobra.Command{
+	Use:   "usage [-u username] [--uid]",
+	Short: "Show the storage usage and quota of user.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfigFromCommand()
+		cliHandleError(err)
+		client := store.NewClient(config)
+		user, err := getUserFromCommand(client)
+		cliHandleError(err)
+		usage, err := client.Usage(user.UID, nil)
+		cliHandleError(err)
+		cliResponse([]types.APIObject{usage.API()})
+	},
+}
+
 func init() {
 	userSubCmd.PersistentFlags().StringP("username", "u", "", "Username of user to get.")
 	userSubCmd.PersistentFlags().String("uid", "", "UID of user to get.")
@@ -124,10 +161,12 @@ func init() {
 	userSetCmd.Flags().StringP("password", "p", "", "Set user password.")
 	userSetCmd.Flags().StringArrayP("groups", "g", []string{}, "Groups to set user to.")
 	userSetCmd.Flags().Bool("disable", false, "Disable user.")
+	userSetCmd.Flags().StringArray("attr", []string{}, "Custom user attribute as 'name=value', i.e. 'teams=[\"red\"]'.")
 
 	userSubCmd.AddCommand(userSetCmd)
 	userSubCmd.AddCommand(userGetCmd)
 	userSubCmd.AddCommand(userDeleteCmd)
+	userSubCmd.AddCommand(userUsageCmd)
 	rootCmd.AddCommand(userSubCmd)
 
 }
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// Eq returns filter matching objects whose field equals value, or contains it when field is an array.
+func Eq(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$eq": value}}
+}
+
+// Ne returns filter matching objects whose field doesn't equal value.
+func Ne(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$ne": value}}
+}
+
+// Gt returns filter matching objects whose field is greater than value.
+func Gt(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$gt": value}}
+}
+
+// Gte returns filter matching objects whose field is greater than or equal to value.
+func Gte(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$gte": value}}
+}
+
+// Lt returns filter matching objects whose field is less than value.
+func Lt(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$lt": value}}
+}
+
+// Lte returns filter matching objects whose field is less than or equal to value.
+func Lte(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$lte": value}}
+}
+
+// In returns filter matching objects whose field equals any of values.
+func In(field string, values ...interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$in": values}}
+}
+
+// Nin returns filter matching objects whose field equals none of values.
+func Nin(field string, values ...interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$nin": values}}
+}
+
+// Contains returns filter matching objects whose array field contains value, or string field contains substring value.
+func Contains(field string, value interface{}) types.Filter {
+	return types.Filter{field: types.Filter{"$contains": value}}
+}
+
+// Exists returns filter matching objects that have, or don't have, field.
+func Exists(field string, exists bool) types.Filter {
+	return types.Filter{field: types.Filter{"$exists": exists}}
+}
+
+// Now returns a filter value of the current time plus offset, i.e. '-7d'.
+func Now(offset string) types.Filter {
+	return types.Filter{"$now": offset}
+}
+
+// Near returns filter matching objects whose geo point field is within km of lat, lng.
+func Near(field string, lat float64, lng float64, km float64) types.Filter {
+	return types.Filter{field: types.Filter{"$near": map[string]interface{}{"lat": lat, "lng": lng, "km": km}}}
+}
+
+// Box returns filter matching objects whose geo point field is inside the bounding box of min and max points.
+func Box(field string, min types.GeoPoint, max types.GeoPoint) types.Filter {
+	return types.Filter{field: types.Filter{"$box": map[string]interface{}{"min": min.Map(), "max": max.Map()}}}
+}
+
+// And returns filter matching objects that match every filter.
+func And(filters ...types.Filter) types.Filter {
+	return types.Filter{"$and": filterList(filters)}
+}
+
+// Or returns filter matching objects that match any filter.
+func Or(filters ...types.Filter) types.Filter {
+	return types.Filter{"$or": filterList(filters)}
+}
+
+// Nor returns filter matching objects that match none of filters.
+func Nor(filters ...types.Filter) types.Filter {
+	return types.Filter{"$nor": filterList(filters)}
+}
+
+func filterList(filters []types.Filter) []interface{} {
+	out := make([]interface{}, 0, len(filters))
+	for _, filter := range filters {
+		out = append(out, filter)
+	}
+	return out
+}
+
+// QueryFilter queries the store API with a filter document.
+func QueryFilter(filter types.Filter, opts types.QueryOptions, key string) (*QueryResult, error) {
+	req := types.APIRequest{
+		SessionKey:   key,
+		Filter:       filter,
+		QueryOptions: opts,
+	}
+	res, err := requestQuery(types.APIQuery, req)
+	return res, errors.WithStack(err)
+}
@@ -42,6 +42,51 @@ func request(res types.APIResource, req types.APIRequest) (types.APIResponse, er
 			endpoint = URL + "/query"
 			break
 		}
+	case types.APIAggregate:
+		{
+			endpoint = URL + "/aggregate"
+			break
+		}
+	case types.APISearch:
+		{
+			endpoint = URL + "/search"
+			break
+		}
+	case types.APISavedQuery:
+		{
+			endpoint = URL + "/saved_query"
+			break
+		}
+	case types.APIShare:
+		{
+			endpoint = URL + "/share"
+			break
+		}
+	case types.APIUserGroups:
+		{
+			endpoint = URL + "/groups"
+			break
+		}
+	case types.APIUserGroupSet:
+		{
+			endpoint = URL + "/groups/set"
+			break
+		}
+	case types.APIUserGroupDelete:
+		{
+			endpoint = URL + "/groups/delete"
+			break
+		}
+	case types.APIPermissionCheck:
+		{
+			endpoint = URL + "/permission/check"
+			break
+		}
+	case types.APIUsage:
+		{
+			endpoint = URL + "/usage"
+			break
+		}
 	}
 	// encode request to json
 	reqJSON, err := json.Marshal(req)
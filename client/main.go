@@ -66,22 +66,212 @@ func Delete(uids []string, key string) error {
 	return errors.WithStack(err)
 }
 
+// Share grants permissions on objects to a principal, 'user:<uid>' or 'group:<name>'. Passing no permissions unshares them.
+func Share(uids []string, principal string, perms []string, key string) ([]*types.Object, error) {
+	apiObjs := make([]types.APIObject, 0)
+	for _, uid := range uids {
+		apiObjs = append(apiObjs, types.APIObject{"_uid": uid})
+	}
+	req := types.APIRequest{
+		SessionKey:  key,
+		Objects:     apiObjs,
+		Principal:   principal,
+		Permissions: perms,
+	}
+	resp, err := request(types.APIShare, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	returnObjs := make([]*types.Object, 0)
+	for _, obj := range resp.Objects {
+		returnObjs = append(returnObjs, obj.Object())
+	}
+	return returnObjs, nil
+}
+
+// UserGroups lists the user groups, admin only.
+func UserGroups(key string) ([]types.APIObject, error) {
+	resp, err := request(types.APIUserGroups, types.APIRequest{SessionKey: key})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	return resp.Objects, nil
+}
+
+// SetUserGroups creates or replaces user groups, each with a 'name' and its permissions. Admin only.
+func SetUserGroups(groups []types.APIObject, key string) ([]types.APIObject, error) {
+	req := types.APIRequest{
+		SessionKey: key,
+		Objects:    groups,
+	}
+	resp, err := request(types.APIUserGroupSet, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	return resp.Objects, nil
+}
+
+// DeleteUserGroups deletes the named user groups, admin only.
+func DeleteUserGroups(names []string, key string) error {
+	groups := make([]types.APIObject, 0)
+	for _, name := range names {
+		groups = append(groups, types.APIObject{"name": name})
+	}
+	req := types.APIRequest{
+		SessionKey: key,
+		Objects:    groups,
+	}
+	resp, err := request(types.APIUserGroupDelete, req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !resp.Success {
+		return errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	return nil
+}
+
+// PermissionCheck explains whether a user, by username or uid, has permission to perform action
+// (get, list, set, update or delete) on the objects of given uids. Admin only.
+func PermissionCheck(uids []string, user string, action string, key string) ([]types.APIObject, error) {
+	apiObjs := make([]types.APIObject, 0)
+	for _, uid := range uids {
+		apiObjs = append(apiObjs, types.APIObject{"_uid": uid})
+	}
+	req := types.APIRequest{
+		SessionKey: key,
+		Objects:    apiObjs,
+		User:       user,
+		Action:     action,
+	}
+	resp, err := request(types.APIPermissionCheck, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	return resp.Objects, nil
+}
+
+// Usage returns the storage usage and quota of the session user, or of another user by username or uid for admins.
+func Usage(user string, key string) (types.APIObject, error) {
+	resp, err := request(types.APIUsage, types.APIRequest{SessionKey: key, User: user})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
+	}
+	if len(resp.Objects) == 0 {
+		return nil, errors.WithStack(ErrResponse)
+	}
+	return resp.Objects[0], nil
+}
+
+// QueryResult is a page of query results from the store API.
+type QueryResult struct {
+	Objects []*types.IndexObject
+	Full    []*types.Object // stored objects, only set when requested in query options
+	Cursor  string          // cursor of the next page, empty when there are no more results
+	Total   int             // total number of matches, only set when requested in query options
+	Explain types.APIObject // how the query was evaluated, only set when requested in query options
+}
+
 // Query queries the store API.
 func Query(query string, key string) ([]*types.IndexObject, error) {
+	res, err := QueryWithOptions(query, types.QueryOptions{}, key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Objects, nil
+}
+
+// QueryWithOptions queries the store API with ordering and pagination options.
+func QueryWithOptions(query string, opts types.QueryOptions, key string) (*QueryResult, error) {
 	req := types.APIRequest{
-		SessionKey: key,
-		Query:      query,
+		SessionKey:   key,
+		Query:        query,
+		QueryOptions: opts,
 	}
-	resp, err := request(types.APIQuery, req)
+	res, err := requestQuery(types.APIQuery, req)
+	return res, errors.WithStack(err)
+}
+
+// Search performs a full-text search of the store API, query optionally filters the results.
+func Search(text string, query string, opts types.QueryOptions, key string) (*QueryResult, error) {
+	req := types.APIRequest{
+		SessionKey:   key,
+		Text:         text,
+		Query:        query,
+		QueryOptions: opts,
+	}
+	res, err := requestQuery(types.APISearch, req)
+	return res, errors.WithStack(err)
+}
+
+// SavedQuery runs the named saved query of the store API with the given parameters.
+func SavedQuery(name string, params map[string]interface{}, opts types.QueryOptions, key string) (*QueryResult, error) {
+	req := types.APIRequest{
+		SessionKey:   key,
+		Name:         name,
+		Params:       params,
+		QueryOptions: opts,
+	}
+	res, err := requestQuery(types.APISavedQuery, req)
+	return res, errors.WithStack(err)
+}
+
+func requestQuery(resource types.APIResource, req types.APIRequest) (*QueryResult, error) {
+	opts := req.QueryOptions
+	resp, err := request(resource, req)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	if !resp.Success {
 		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
 	}
-	objs := make([]*types.IndexObject, 0)
+	res := &QueryResult{
+		Objects: make([]*types.IndexObject, 0),
+		Cursor:  resp.Cursor,
+		Explain: resp.Explain,
+	}
+	if resp.Total != nil {
+		res.Total = *resp.Total
+	}
 	for _, obj := range resp.Objects {
-		objs = append(objs, obj.Object().Index())
+		res.Objects = append(res.Objects, obj.Object().Index())
+		if opts.Full {
+			res.Full = append(res.Full, obj.Object())
+		}
+	}
+	return res, nil
+}
+
+// Aggregate computes aggregate functions, i.e. 'count' or 'sum(views)', over the objects
+// matching query, grouped by the given fields.
+func Aggregate(query string, groupBy []string, aggregates []string, key string) ([]types.APIObject, error) {
+	req := types.APIRequest{
+		SessionKey: key,
+		Query:      query,
+		GroupBy:    groupBy,
+		Aggregates: aggregates,
+	}
+	resp, err := request(types.APIAggregate, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !resp.Success {
+		return nil, errors.WithStack(errors.WithMessage(ErrResponse, resp.Message))
 	}
-	return objs, nil
+	return resp.Objects, nil
 }
@@ -15,9 +15,8 @@ require (
 )
 
 require (
-	github.com/antlr/antlr4 v0.0.0-20210121092344-5dce78c87a9e // indirect
-	github.com/caibirdme/yql v0.0.0-20210122071211-a800d6de28a0 // indirect
 	github.com/go-redis/redis v6.15.6+incompatible // indirect
+	github.com/kljensen/snowball v0.6.0 // indirect
 	github.com/matoous/go-nanoid/v2 v2.0.0 // indirect
 	github.com/philippgille/gokv v0.6.0 // indirect
 	github.com/philippgille/gokv/encoding v0.0.0-20191011213304-eb77f15b9c61 // indirect
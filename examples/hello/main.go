@@ -23,13 +23,12 @@ func main() {
 	}
 
 	// fetch existing, or create new
-	res, err := client.Query("id = 'name'", "")
+	res, err := client.QueryFilter(client.Eq("id", "name"), types.QueryOptions{Full: true, Limit: 1}, "")
 	if err != nil {
 		panic(err)
 	}
-	if len(res) > 0 {
-		p.Object.UID = res[0].UID
-		p.Object.Data["name"] = res[0].Data["name"]
+	if len(res.Full) > 0 {
+		p.Object = res.Full[0]
 	} else {
 		objs, err := client.Set([]*types.Object{p.Object}, "")
 		if err != nil {
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -27,8 +28,15 @@ func logAPIRequest(req types.APIRequest, res types.APIResource) {
 		if newObjCt > 0 {
 			objString += fmt.Sprintf(" + %d new", newObjCt)
 		}
+	} else if req.Text != "" {
+		objString += " " + req.Text
 	} else if req.Query != "" {
 		objString += " " + req.Query
+	} else if req.Name != "" {
+		objString += " " + req.Name
+	} else if req.Filter != nil {
+		rawFilter, _ := json.Marshal(req.Filter)
+		objString += " " + string(rawFilter)
 	}
 	logInfo(
 		fmt.Sprintf("@%s - %s%s", userIdentity, res.Name(), objString),
@@ -20,7 +20,7 @@ func errHTTPResponseCode(err error) int {
 		{
 			return http.StatusNotFound
 		}
-	case store.ErrInvalidArg, store.ErrObjectNotSpecified:
+	case store.ErrInvalidArg, store.ErrObjectNotSpecified, store.ErrInvalidCursor, store.ErrInvalidQuery:
 		{
 			return http.StatusBadRequest
 		}
@@ -36,6 +36,30 @@ func errHTTPResponseCode(err error) int {
 		{
 			return http.StatusMethodNotAllowed
 		}
+	case store.ErrQueryLimit:
+		{
+			return http.StatusUnprocessableEntity
+		}
+	case store.ErrQueryTimeout:
+		{
+			return http.StatusServiceUnavailable
+		}
+	case store.ErrRateLimit:
+		{
+			return http.StatusTooManyRequests
+		}
+	case store.ErrQuota:
+		{
+			return http.StatusForbidden
+		}
+	case store.ErrConflict:
+		{
+			return http.StatusConflict
+		}
+	case store.ErrNotSupported:
+		{
+			return http.StatusNotImplemented
+		}
 	}
 	return http.StatusInternalServerError
 }
@@ -1,11 +1,15 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,7 +18,10 @@ import (
 	"gitlab.com/contextualcode/go-object-store/types"
 )
 
-const anonymousUser = "anonymous"
+const (
+	anonymousUser         = "anonymous"
+	savedQueryParamPrefix = "param."
+)
 
 var client *store.Client
 
@@ -34,12 +41,24 @@ func Listen(config *store.Config) error {
 			return errors.WithStack(err)
 		}
 	}
+	// keep the index in sync with other instances sharing the storage
+	client.StartSync(config.Sync)
 	// endpoints
 	http.HandleFunc("/login", login)
 	http.HandleFunc("/set", set)
 	http.HandleFunc("/get", get)
 	http.HandleFunc("/delete", delete)
 	http.HandleFunc("/query", query)
+	http.HandleFunc("/aggregate", aggregate)
+	http.HandleFunc("/search", search)
+	http.HandleFunc("/saved_query", savedQuery)
+	http.HandleFunc("/share", share)
+	http.HandleFunc("/groups", userGroups)
+	http.HandleFunc("/groups/set", userGroupSet)
+	http.HandleFunc("/groups/delete", userGroupDelete)
+	http.HandleFunc("/permission/check", permissionCheck)
+	http.HandleFunc("/usage", usage)
+	http.HandleFunc("/metrics", metrics)
 	// serve http
 	logInfo(fmt.Sprintf("Start HTTP server on port %d.", config.HTTP.Port))
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", config.HTTP.Port), nil); err != nil {
@@ -65,6 +84,56 @@ func parsePostBody(r *http.Request) (types.APIRequest, error) {
 	return apiReq, nil
 }
 
+// parseQueryOptions reads query options from url query parameters.
+func parseQueryOptions(r *http.Request) (types.QueryOptions, error) {
+	opts := types.QueryOptions{
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	for _, sort := range r.URL.Query()["sort"] {
+		for _, field := range strings.Split(sort, ",") {
+			if field != "" {
+				opts.Sort = append(opts.Sort, field)
+			}
+		}
+	}
+	for _, fields := range r.URL.Query()["fields"] {
+		for _, field := range strings.Split(fields, ",") {
+			if field != "" {
+				opts.Fields = append(opts.Fields, field)
+			}
+		}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return opts, errors.WithStack(store.ErrInvalidArg)
+		}
+	}
+	if total := r.URL.Query().Get("total"); total != "" {
+		var err error
+		opts.Total, err = strconv.ParseBool(total)
+		if err != nil {
+			return opts, errors.WithStack(store.ErrInvalidArg)
+		}
+	}
+	if full := r.URL.Query().Get("full"); full != "" {
+		var err error
+		opts.Full, err = strconv.ParseBool(full)
+		if err != nil {
+			return opts, errors.WithStack(store.ErrInvalidArg)
+		}
+	}
+	if explain := r.URL.Query().Get("explain"); explain != "" {
+		var err error
+		opts.Explain, err = strconv.ParseBool(explain)
+		if err != nil {
+			return opts, errors.WithStack(store.ErrInvalidArg)
+		}
+	}
+	return opts, nil
+}
+
 func getUserFromSessionKey(key string) (*types.User, error) {
 	if key == "" {
 		user, err := client.GetUserByUsername(anonymousUser)
@@ -78,6 +147,28 @@ func getUserFromSessionKey(key string) (*types.User, error) {
 	return user, errors.WithStack(err)
 }
 
+// checkRateLimit takes a request token from the session user, or from the IP address of
+// anonymous requests and requests with an invalid session.
+func checkRateLimit(req types.APIRequest) (time.Duration, error) {
+	user, err := getUserFromSessionKey(req.SessionKey)
+	key := ""
+	if err == nil && req.SessionKey != "" {
+		key = "user:" + user.UID
+	} else {
+		user, err = getUserFromSessionKey("")
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		host, _, err := net.SplitHostPort(req.IP)
+		if err != nil {
+			host = req.IP
+		}
+		key = "ip:" + host
+	}
+	retryAfter, err := client.CheckRateLimit(key, user)
+	return retryAfter, errors.WithStack(err)
+}
+
 func errorResponse(w http.ResponseWriter, err error) {
 	logWarnErr(err, "")
 	sendResponse(w, errHTTPResponseCode(err), &types.APIResponse{
@@ -105,8 +196,21 @@ func sendResponse(w http.ResponseWriter, status int, resp *types.APIResponse) {
 }
 
 func request(res types.APIResource, req types.APIRequest, w http.ResponseWriter) {
+	requestContext(context.Background(), res, req, w)
+}
+
+// requestContext is request that stops evaluating queries when ctx is done, i.e. when the client disconnects.
+func requestContext(ctx context.Context, res types.APIResource, req types.APIRequest, w http.ResponseWriter) {
 	// log request
 	logAPIRequest(req, res)
+	// rate limit
+	if retryAfter, err := checkRateLimit(req); err != nil {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		errorResponse(w, err)
+		return
+	}
 	// handle request
 	switch res {
 	case types.APILogin:
@@ -228,7 +332,106 @@ func request(res types.APIResource, req types.APIRequest, w http.ResponseWriter)
 				Success: true,
 			})
 		}
+	case types.APIShare:
+		{
+			if len(req.Objects) == 0 {
+				errorResponse(w, store.ErrObjectNotSpecified)
+				return
+			}
+			if req.Principal == "" {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			respObjs := make([]types.APIObject, 0)
+			for _, o := range req.Objects {
+				if o == nil {
+					continue
+				}
+				shared, err := client.Share(o.Object().UID, req.Principal, req.Permissions, user)
+				if err != nil {
+					errorResponse(w, err)
+					return
+				}
+				respObjs = append(respObjs, shared.API())
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+				Objects: respObjs,
+			})
+			return
+		}
 	case types.APIQuery:
+		{
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			// query string or filter document, not both
+			if (req.Query == "") == (req.Filter == nil) {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			var res *store.QueryResult
+			if req.Filter != nil {
+				res, err = client.QueryFilterContext(ctx, req.Filter, req.QueryOptions, user)
+			} else {
+				res, err = client.QueryContext(ctx, req.Query, req.QueryOptions, user)
+			}
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			resp := &types.APIResponse{
+				Success: true,
+				Objects: res.API(),
+				Cursor:  res.Cursor,
+			}
+			if req.Total {
+				resp.Total = &res.Total
+			}
+			if res.Explain != nil {
+				resp.Explain = res.Explain.API()
+			}
+			sendResponse(w, http.StatusOK, resp)
+			return
+		}
+	case types.APISavedQuery:
+		{
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			if req.Name == "" {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			res, err := client.SavedQueryContext(ctx, req.Name, req.Params, req.QueryOptions, user)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			resp := &types.APIResponse{
+				Success: true,
+				Objects: res.API(),
+				Cursor:  res.Cursor,
+			}
+			if req.Total {
+				resp.Total = &res.Total
+			}
+			if res.Explain != nil {
+				resp.Explain = res.Explain.API()
+			}
+			sendResponse(w, http.StatusOK, resp)
+			return
+		}
+	case types.APIAggregate:
 		{
 			user, err := getUserFromSessionKey(req.SessionKey)
 			if err != nil {
@@ -239,14 +442,153 @@ func request(res types.APIResource, req types.APIRequest, w http.ResponseWriter)
 				errorResponse(w, store.ErrInvalidArg)
 				return
 			}
-			objs, err := client.Query(req.Query, user)
+			respObjs, err := client.AggregateContext(ctx, req.Query, req.GroupBy, req.Aggregates, user)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+				Objects: respObjs,
+			})
+			return
+		}
+	case types.APISearch:
+		{
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			if req.Text == "" {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			res, err := client.SearchContext(ctx, req.Text, req.Query, req.QueryOptions, user)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			resp := &types.APIResponse{
+				Success: true,
+				Objects: res.API(),
+				Cursor:  res.Cursor,
+			}
+			if req.Total {
+				resp.Total = &res.Total
+			}
+			sendResponse(w, http.StatusOK, resp)
+			return
+		}
+	case types.APIUserGroups:
+		{
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			userGroups, err := client.UserGroups(user)
 			if err != nil {
 				errorResponse(w, err)
 				return
 			}
 			respObjs := make([]types.APIObject, 0)
-			for _, o := range objs {
-				respObjs = append(respObjs, o.API())
+			for _, userGroup := range userGroups {
+				respObjs = append(respObjs, userGroup.API())
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+				Objects: respObjs,
+			})
+			return
+		}
+	case types.APIUserGroupSet:
+		{
+			if len(req.Objects) == 0 {
+				errorResponse(w, store.ErrObjectNotSpecified)
+				return
+			}
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			respObjs := make([]types.APIObject, 0)
+			for _, o := range req.Objects {
+				if o == nil {
+					continue
+				}
+				userGroup, err := store.ParseUserGroup(o)
+				if err != nil {
+					errorResponse(w, err)
+					return
+				}
+				if err := client.SetUserGroup(userGroup.Name, userGroup.UserGroup, user); err != nil {
+					errorResponse(w, err)
+					return
+				}
+				respObjs = append(respObjs, userGroup.API())
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+				Objects: respObjs,
+			})
+			return
+		}
+	case types.APIUserGroupDelete:
+		{
+			if len(req.Objects) == 0 {
+				errorResponse(w, store.ErrObjectNotSpecified)
+				return
+			}
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			for _, o := range req.Objects {
+				name, _ := o["name"].(string)
+				if err := client.DeleteUserGroup(name, user); err != nil {
+					errorResponse(w, err)
+					return
+				}
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+			})
+			return
+		}
+	case types.APIPermissionCheck:
+		{
+			if len(req.Objects) == 0 {
+				errorResponse(w, store.ErrObjectNotSpecified)
+				return
+			}
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			if !client.IsAdmin(user) {
+				errorResponse(w, store.ErrPermission)
+				return
+			}
+			checkUser, err := client.FindUser(req.User)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			respObjs := make([]types.APIObject, 0)
+			for _, o := range req.Objects {
+				if o == nil {
+					continue
+				}
+				explain, err := client.ExplainPermission(req.Action, o.Object().UID, checkUser, user)
+				if err != nil {
+					errorResponse(w, err)
+					return
+				}
+				respObjs = append(respObjs, explain.API())
 			}
 			sendResponse(w, http.StatusOK, &types.APIResponse{
 				Success: true,
@@ -254,6 +596,37 @@ func request(res types.APIResource, req types.APIRequest, w http.ResponseWriter)
 			})
 			return
 		}
+	case types.APIUsage:
+		{
+			user, err := getUserFromSessionKey(req.SessionKey)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			uid := user.UID
+			if req.User != "" {
+				if !client.IsAdmin(user) {
+					errorResponse(w, store.ErrPermission)
+					return
+				}
+				usageUser, err := client.FindUser(req.User)
+				if err != nil {
+					errorResponse(w, err)
+					return
+				}
+				uid = usageUser.UID
+			}
+			usage, err := client.Usage(uid, user)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			sendResponse(w, http.StatusOK, &types.APIResponse{
+				Success: true,
+				Objects: []types.APIObject{usage.API()},
+			})
+			return
+		}
 	}
 	errorResponse(w, ErrInvalidResource)
 }
@@ -296,6 +669,7 @@ func get(w http.ResponseWriter, r *http.Request) {
 		{
 			uids := strings.Split(r.URL.Query().Get("uid"), ",")
 			req := types.APIRequest{
+				IP:         r.RemoteAddr,
 				SessionKey: r.URL.Query().Get("key"),
 				Objects:    make([]types.APIObject, 0),
 			}
@@ -338,6 +712,54 @@ func delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func query(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			q := r.URL.Query().Get("q")
+			if q == "" {
+				q = r.URL.Query().Get("query")
+			}
+			var filter types.Filter
+			if rawFilter := r.URL.Query().Get("filter"); rawFilter != "" {
+				if err := json.Unmarshal([]byte(rawFilter), &filter); err != nil {
+					errorResponse(w, store.ErrInvalidQuery)
+					return
+				}
+			}
+			if q == "" && filter == nil {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			opts, err := parseQueryOptions(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			req := types.APIRequest{
+				IP:           r.RemoteAddr,
+				SessionKey:   r.URL.Query().Get("key"),
+				Query:        q,
+				Filter:       filter,
+				QueryOptions: opts,
+			}
+			requestContext(r.Context(), types.APIQuery, req, w)
+			return
+		}
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			requestContext(r.Context(), types.APIQuery, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func aggregate(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		{
@@ -350,10 +772,214 @@ func query(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			req := types.APIRequest{
+				IP:         r.RemoteAddr,
 				SessionKey: r.URL.Query().Get("key"),
 				Query:      q,
+				Aggregates: r.URL.Query()["aggregate"],
+			}
+			for _, groupBy := range r.URL.Query()["group_by"] {
+				for _, field := range strings.Split(groupBy, ",") {
+					if field != "" {
+						req.GroupBy = append(req.GroupBy, field)
+					}
+				}
+			}
+			requestContext(r.Context(), types.APIAggregate, req, w)
+			return
+		}
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			requestContext(r.Context(), types.APIAggregate, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func search(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			text := r.URL.Query().Get("text")
+			if text == "" {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			opts, err := parseQueryOptions(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			req := types.APIRequest{
+				IP:           r.RemoteAddr,
+				SessionKey:   r.URL.Query().Get("key"),
+				Text:         text,
+				Query:        r.URL.Query().Get("q"),
+				QueryOptions: opts,
+			}
+			requestContext(r.Context(), types.APISearch, req, w)
+			return
+		}
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			requestContext(r.Context(), types.APISearch, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func savedQuery(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				errorResponse(w, store.ErrInvalidArg)
+				return
+			}
+			opts, err := parseQueryOptions(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			req := types.APIRequest{
+				IP:           r.RemoteAddr,
+				SessionKey:   r.URL.Query().Get("key"),
+				Name:         name,
+				Params:       make(map[string]interface{}),
+				QueryOptions: opts,
+			}
+			// parameters are passed as 'param.<name>=<value>'
+			for k, v := range r.URL.Query() {
+				if strings.HasPrefix(k, savedQueryParamPrefix) && len(v) > 0 {
+					req.Params[strings.TrimPrefix(k, savedQueryParamPrefix)] = v[0]
+				}
+			}
+			requestContext(r.Context(), types.APISavedQuery, req, w)
+			return
+		}
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			requestContext(r.Context(), types.APISavedQuery, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func share(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			request(types.APIShare, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func userGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			request(types.APIUserGroups, types.APIRequest{
+				IP:         r.RemoteAddr,
+				SessionKey: r.URL.Query().Get("key"),
+			}, w)
+			return
+		}
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
 			}
-			request(types.APIQuery, req, w)
+			request(types.APIUserGroups, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func userGroupSet(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			request(types.APIUserGroupSet, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func userGroupDelete(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost, http.MethodDelete:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			request(types.APIUserGroupDelete, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func permissionCheck(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		{
+			req, err := parsePostBody(r)
+			if err != nil {
+				errorResponse(w, err)
+				return
+			}
+			request(types.APIPermissionCheck, req, w)
+			return
+		}
+	}
+	errorResponse(w, ErrAPIInvalidMethod)
+}
+
+func usage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			request(types.APIUsage, types.APIRequest{
+				IP:         r.RemoteAddr,
+				SessionKey: r.URL.Query().Get("key"),
+				User:       r.URL.Query().Get("user"),
+			}, w)
 			return
 		}
 	case http.MethodPost:
@@ -363,7 +989,7 @@ func query(w http.ResponseWriter, r *http.Request) {
 				errorResponse(w, err)
 				return
 			}
-			request(types.APIQuery, req, w)
+			request(types.APIUsage, req, w)
 			return
 		}
 	}
@@ -2,11 +2,15 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,8 +37,17 @@ func initTestServer() {
 			Set:    true,
 			Update: true,
 			Delete: true,
+			Admin:  true,
 		},
 	}
+	c.UserGroups["limited"] = store.UserGroup{Get: true, RateLimit: 2, RateWindow: 60000}
+	c.Queries = map[string]store.SavedQuery{
+		"by_name": {
+			Query:  "type = 'saved' and name = $name",
+			Params: map[string]string{"name": "string"},
+		},
+	}
+	c.Sync.Interval = 100
 	c.HTTP.Port = testHTTPPort
 	go Listen(c)
 	time.Sleep(time.Second)
@@ -172,3 +185,381 @@ func TestHTTPLogin(t *testing.T) {
 	}
 
 }
+
+func TestHTTPQueryPaginate(t *testing.T) {
+	initTestServer()
+
+	// create objects
+	for i := 0; i < 5; i++ {
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"type":  "paginate",
+				"order": i,
+			},
+		}, nil)
+	}
+
+	// fetch pages
+	cursor := ""
+	orders := make([]float64, 0)
+	for {
+		resp, err := http.Get(
+			fmt.Sprintf("http://localhost:%d/query?q=type+%%3D+'paginate'&sort=-order&limit=2&total=true&cursor=%s", testHTTPPort, cursor),
+		)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Error("unexpected status")
+			return
+		}
+		apiResp := types.APIResponse{}
+		respRaw, _ := ioutil.ReadAll(resp.Body)
+		json.Unmarshal(respRaw, &apiResp)
+		if apiResp.Total == nil || *apiResp.Total != 5 {
+			t.Error("expected total in response")
+			return
+		}
+		for _, o := range apiResp.Objects {
+			orders = append(orders, o["order"].(float64))
+		}
+		if apiResp.Cursor == "" {
+			break
+		}
+		cursor = apiResp.Cursor
+	}
+	if len(orders) != 5 || orders[0] != 4 || orders[4] != 0 {
+		t.Error("unexpected query results")
+	}
+}
+
+func TestHTTPQueryFilter(t *testing.T) {
+	initTestServer()
+
+	client.Set(&types.Object{
+		Data: map[string]interface{}{
+			"type": "filter",
+			"name": "it's quoted",
+		},
+	}, nil)
+	client.Set(&types.Object{
+		Data: map[string]interface{}{
+			"type": "filter",
+			"name": "plain",
+		},
+	}, nil)
+
+	reqJSON, _ := json.Marshal(types.APIRequest{
+		Filter: types.Filter{
+			"type": "filter",
+			"name": map[string]interface{}{"$in": []interface{}{"it's quoted", "missing"}},
+		},
+	})
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/query", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Error("unexpected status")
+		return
+	}
+	apiResp := types.APIResponse{}
+	respRaw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(respRaw, &apiResp)
+	if len(apiResp.Objects) != 1 || apiResp.Objects[0]["name"] != "it's quoted" {
+		t.Error("unexpected query results")
+	}
+
+	// unknown operators are rejected
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/query?filter=%s", testHTTPPort, `{"name":{"$regex":"x"}}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("expected bad request status")
+	}
+}
+
+func TestHTTPSavedQuery(t *testing.T) {
+	initTestServer()
+
+	client.Set(&types.Object{
+		Data: map[string]interface{}{
+			"type": "saved",
+			"name": "first",
+		},
+	}, nil)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/saved_query?name=by_name&param.name=first", testHTTPPort))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Error("unexpected status")
+		return
+	}
+	apiResp := types.APIResponse{}
+	respRaw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(respRaw, &apiResp)
+	if len(apiResp.Objects) != 1 || apiResp.Objects[0]["name"] != "first" {
+		t.Error("unexpected query results")
+	}
+
+	// missing parameter
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/saved_query?name=by_name", testHTTPPort))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("expected bad request status")
+	}
+}
+
+func TestHTTPQueryContext(t *testing.T) {
+	initTestServer()
+
+	client.Set(&types.Object{
+		Data: map[string]interface{}{
+			"type": "saved",
+			"name": "context",
+		},
+	}, nil)
+
+	// queries stop when the request is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for path, handler := range map[string]http.HandlerFunc{
+		"/query?q=type+%3D+'saved'":                     query,
+		"/saved_query?name=by_name&param.name=context":  savedQuery,
+		"/aggregate?q=type+%3D+'saved'&aggregate=count": aggregate,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		if w.Code == http.StatusOK {
+			t.Errorf("expected canceled query to fail for %s", path)
+		}
+	}
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	initTestServer()
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", testHTTPPort))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(raw), "object_store_sync_lag_seconds ") {
+		t.Errorf("expected sync lag metric, got %s", string(raw))
+	}
+	if strings.Contains(string(raw), "object_store_syncs_total 0\n") {
+		t.Error("expected background syncs")
+	}
+}
+
+func TestHTTPShare(t *testing.T) {
+	initTestServer()
+	o := &types.Object{Data: map[string]interface{}{"type": "shared"}}
+	client.Set(o, nil)
+
+	// anonymous user isn't the author nor an admin
+	req := types.APIRequest{
+		Objects:     []types.APIObject{{"_uid": o.UID}},
+		Principal:   "group:editors",
+		Permissions: []string{"get", "update"},
+	}
+	reqJSON, _ := json.Marshal(req)
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/share", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expected unauthorized status")
+	}
+
+	// author can share
+	u := &types.User{Username: "shareauthor", Groups: []string{"admin"}}
+	store.SetPassword("test1234", u)
+	client.SetUser(u)
+	o.Author = u.UID
+	client.Set(o, nil)
+	loginJSON, _ := json.Marshal(types.APIRequest{Username: u.Username, Password: "test1234"})
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/login", testHTTPPort), "application/json", bytes.NewReader(loginJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp := types.APIResponse{}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	req.SessionKey = apiResp.Key
+	reqJSON, _ = json.Marshal(req)
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/share", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp = types.APIResponse{}
+	raw, _ = ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	if resp.StatusCode != http.StatusOK || len(apiResp.Objects) != 1 {
+		t.Errorf("unexpected response %s", string(raw))
+		return
+	}
+	acl := apiResp.Objects[0].Object().ACL
+	if len(acl) != 1 || acl[0].Principal != "group:editors" || len(acl[0].Permissions) != 2 {
+		t.Errorf("unexpected access control list %+v", acl)
+	}
+}
+
+func TestHTTPUserGroups(t *testing.T) {
+	initTestServer()
+	group := types.APIObject{"name": "reviewers", "inherits": []string{"anonymous"}, "update": "type = 'review'"}
+	reqJSON, _ := json.Marshal(types.APIRequest{Objects: []types.APIObject{group}})
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/groups/set", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expected unauthorized status")
+	}
+
+	// admins can manage groups
+	u := &types.User{Username: "groupadmin", Groups: []string{"admin"}}
+	store.SetPassword("test1234", u)
+	client.SetUser(u)
+	loginJSON, _ := json.Marshal(types.APIRequest{Username: u.Username, Password: "test1234"})
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/login", testHTTPPort), "application/json", bytes.NewReader(loginJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp := types.APIResponse{}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	key := apiResp.Key
+	reqJSON, _ = json.Marshal(types.APIRequest{SessionKey: key, Objects: []types.APIObject{group}})
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/groups/set", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		raw, _ = ioutil.ReadAll(resp.Body)
+		t.Errorf("unexpected response %s", string(raw))
+		return
+	}
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/groups?key=%s", testHTTPPort, key))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp = types.APIResponse{}
+	raw, _ = ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	found := false
+	for _, o := range apiResp.Objects {
+		if o["name"] == "reviewers" && o["config"] == false {
+			found = true
+		} else if o["name"] == "admin" && o["config"] != true {
+			t.Error("expected admin group to be from the config")
+		}
+	}
+	if !found {
+		t.Errorf("expected stored group in %s", string(raw))
+	}
+
+	// configured groups can't be changed
+	reqJSON, _ = json.Marshal(types.APIRequest{SessionKey: key, Objects: []types.APIObject{{"name": "anonymous"}}})
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/groups/delete", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expected unauthorized status")
+	}
+}
+
+func TestHTTPPermissionCheck(t *testing.T) {
+	initTestServer()
+	o := &types.Object{Data: map[string]interface{}{"type": "checked"}}
+	client.Set(o, nil)
+	req := types.APIRequest{
+		Objects: []types.APIObject{{"_uid": o.UID}},
+		User:    anonymousUser,
+		Action:  "get",
+	}
+	reqJSON, _ := json.Marshal(req)
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/permission/check", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expected unauthorized status")
+	}
+
+	// admins can explain
+	u := &types.User{Username: "permadmin", Groups: []string{"admin"}}
+	store.SetPassword("test1234", u)
+	client.SetUser(u)
+	loginJSON, _ := json.Marshal(types.APIRequest{Username: u.Username, Password: "test1234"})
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/login", testHTTPPort), "application/json", bytes.NewReader(loginJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp := types.APIResponse{}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	req.SessionKey = apiResp.Key
+	reqJSON, _ = json.Marshal(req)
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%d/permission/check", testHTTPPort), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp = types.APIResponse{}
+	raw, _ = ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	if resp.StatusCode != http.StatusOK || len(apiResp.Objects) != 1 || apiResp.Objects[0]["allowed"] != true {
+		t.Errorf("unexpected response %s", string(raw))
+	}
+}
+
+func TestHTTPRateLimit(t *testing.T) {
+	initTestServer()
+	u := &types.User{Username: "limited", Groups: []string{"limited"}}
+	store.SetPassword("test1234", u)
+	client.SetUser(u)
+	loginJSON, _ := json.Marshal(types.APIRequest{Username: u.Username, Password: "test1234"})
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/login", testHTTPPort), "application/json", bytes.NewReader(loginJSON))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiResp := types.APIResponse{}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(raw, &apiResp)
+	for i := 0; i < 3; i++ {
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d/query?q=type%%3D'limited'&key=%s", testHTTPPort, apiResp.Key))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected too many requests status, got %d", resp.StatusCode)
+	}
+	if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retryAfter <= 0 || retryAfter > 30 {
+		t.Errorf("unexpected retry after %s", resp.Header.Get("Retry-After"))
+	}
+}
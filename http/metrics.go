@@ -0,0 +1,35 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// metrics writes the store metrics in the Prometheus text format.
+func metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status := client.SyncStatus()
+	lastSync := float64(0)
+	if !status.LastSync.IsZero() {
+		lastSync = float64(status.LastSync.UnixNano()) / 1e9
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP object_store_sync_lag_seconds Seconds since the index was last synced with the storage.\n")
+	fmt.Fprintf(w, "# TYPE object_store_sync_lag_seconds gauge\n")
+	fmt.Fprintf(w, "object_store_sync_lag_seconds %g\n", status.Lag().Seconds())
+	fmt.Fprintf(w, "# HELP object_store_sync_last_success_timestamp_seconds Time of the last successful index sync.\n")
+	fmt.Fprintf(w, "# TYPE object_store_sync_last_success_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "object_store_sync_last_success_timestamp_seconds %g\n", lastSync)
+	fmt.Fprintf(w, "# HELP object_store_syncs_total Number of successful index syncs.\n")
+	fmt.Fprintf(w, "# TYPE object_store_syncs_total counter\n")
+	fmt.Fprintf(w, "object_store_syncs_total %d\n", status.Syncs)
+	fmt.Fprintf(w, "# HELP object_store_sync_errors_total Number of failed index syncs.\n")
+	fmt.Fprintf(w, "# TYPE object_store_sync_errors_total counter\n")
+	fmt.Fprintf(w, "object_store_sync_errors_total %d\n", status.Errors)
+	fmt.Fprintf(w, "# HELP object_store_sync_shards Number of index shards reloaded by the last sync.\n")
+	fmt.Fprintf(w, "# TYPE object_store_sync_shards gauge\n")
+	fmt.Fprintf(w, "object_store_sync_shards %d\n", status.Shards)
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// aclPermissions are the permissions an access control list can grant, objects can't be shared for creation.
+var aclPermissions = []string{permGet, permUpdate, permDelete}
+
+// checkACL returns true if the access control list of object grants permission to user,
+// objects shared for 'get' can also be listed.
+func checkACL(perm string, u *types.User, o *types.IndexObject) bool {
+	if perm == permList {
+		perm = permGet
+	}
+	for _, e := range o.ACL {
+		if e.Grants(u, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateACL returns an error if an access control list entry is malformed.
+func validateACL(acl []types.ACLEntry) error {
+	for _, e := range acl {
+		name := strings.TrimPrefix(strings.TrimPrefix(e.Principal, types.ACLUserPrefix), types.ACLGroupPrefix)
+		if name == "" || name == e.Principal {
+			return errors.Wrapf(ErrInvalidArg, "invalid principal %s", e.Principal)
+		}
+		for _, perm := range e.Permissions {
+			valid := false
+			for _, p := range aclPermissions {
+				valid = valid || perm == p
+			}
+			if !valid {
+				return errors.Wrapf(ErrInvalidArg, "invalid permission %s", perm)
+			}
+		}
+	}
+	return nil
+}
+
+// canManageACL returns true if user may edit the access control list of object, only its author and admins can.
+func (c *Client) canManageACL(u *types.User, o *types.Object) bool {
+	return (u != nil && u.UID != "" && o.Author == u.UID) || c.IsAdmin(u)
+}
+
+// aclReader decides which access control lists a user can see, only those of the objects
+// they author or every list for admins, so readers can't see who else an object is shared with.
+type aclReader struct {
+	uid   string
+	admin bool
+}
+
+func (c *Client) getACLReader(u *types.User) aclReader {
+	if u == nil {
+		return aclReader{admin: true}
+	}
+	return aclReader{uid: u.UID, admin: c.IsAdmin(u)}
+}
+
+// visible returns true if the access control list of objects authored by author can be seen.
+func (r aclReader) visible(author string) bool {
+	return r.admin || (r.uid != "" && author == r.uid)
+}
+
+// stripIndex returns index object without its access control list when it can't be seen.
+func (r aclReader) stripIndex(o *types.IndexObject) *types.IndexObject {
+	if o.ACL == nil || r.visible(o.Author) {
+		return o
+	}
+	out := *o
+	out.ACL = nil
+	return &out
+}
+
+// checkACLWrite keeps the stored access control list when object doesn't set one and
+// checks that user may change it otherwise.
+func (c *Client) checkACLWrite(u *types.User, o *types.Object, existing *types.Object) error {
+	if existing == nil {
+		return errors.WithStack(validateACL(o.ACL))
+	}
+	if o.ACL == nil {
+		o.ACL = existing.ACL
+		return nil
+	}
+	if sameValue(o.ACL, existing.ACL) || (len(o.ACL) == 0 && len(existing.ACL) == 0) {
+		return nil
+	}
+	if !c.canManageACL(u, existing) {
+		return errors.Wrap(ErrPermission, "only the author and admins can change the access control list")
+	}
+	return errors.WithStack(validateACL(o.ACL))
+}
+
+// Share grants permissions on object to a principal, 'user:<uid>' or 'group:<name>',
+// replacing the permissions it had. Passing no permissions unshares the object.
+func (c *Client) Share(uid string, principal string, perms []string, u *types.User) (*types.Object, error) {
+	o, err := c.Get(uid, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	acl := make([]types.ACLEntry, 0, len(o.ACL)+1)
+	for _, e := range o.ACL {
+		if e.Principal != principal {
+			acl = append(acl, e)
+		}
+	}
+	if len(perms) > 0 {
+		acl = append(acl, types.ACLEntry{Principal: principal, Permissions: perms})
+	}
+	o.ACL = acl
+	if err := c.Set(o, u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return o, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestACL(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"member": {Get: "public = true", Set: true},
+			"team":   {Get: false},
+			"admin":  {Get: true, Set: true, Update: true, Delete: true, Admin: true},
+		},
+	})
+	author := &types.User{UID: "author", Groups: []string{"member"}}
+	friend := &types.User{UID: "friend", Groups: []string{"member"}}
+	teammate := &types.User{UID: "teammate", Groups: []string{"team"}}
+	admin := &types.User{UID: "admin", Groups: []string{"admin"}}
+	o := &types.Object{Data: map[string]interface{}{"type": "doc", "public": false}}
+	if err := client.Set(o, author); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := client.Get(o.UID, friend); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error before sharing")
+	}
+
+	// author shares the object with a user and a group
+	if _, err := client.Share(o.UID, types.ACLUserPrefix+friend.UID, []string{permGet, permUpdate}, author); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := client.Share(o.UID, types.ACLGroupPrefix+"team", []string{permGet}, author); err != nil {
+		t.Error(err)
+		return
+	}
+	shared, err := client.Get(o.UID, friend)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// only the author and admins see who else the object is shared with
+	if shared.ACL != nil {
+		t.Error("expected access control list to be hidden from reader")
+	}
+	if own, _ := client.Get(o.UID, author); len(own.ACL) != 2 {
+		t.Error("expected two access control list entries")
+	}
+	if res, _ := client.Query("type = 'doc'", teammate); len(res) != 1 || res[0].ACL != nil || res[0].API()["_acl"] != nil {
+		t.Error("expected group to query shared object without its access control list")
+	}
+	if res, _ := client.Query("type = 'doc'", admin); len(res) != 1 || len(res[0].ACL) != 2 {
+		t.Error("expected admin to see the access control list")
+	}
+
+	// users the object is shared with can update it but not its access control list
+	shared.Data["title"] = "Shared"
+	shared.ACL = nil
+	if err := client.Set(shared, friend); err != nil {
+		t.Error(err)
+	}
+	if stored, _ := client.Get(o.UID, nil); len(stored.ACL) != 2 || stored.Data["title"] != "Shared" {
+		t.Error("expected access control list to be kept")
+	}
+	shared.ACL = []types.ACLEntry{{Principal: types.ACLUserPrefix + "mallory", Permissions: []string{permDelete}}}
+	if err := client.Set(shared, friend); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error changing access control list")
+	}
+	if err := client.Delete(&types.Object{UID: o.UID}, friend); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error on delete")
+	}
+	if _, err := client.Share(o.UID, types.ACLUserPrefix+"mallory", []string{"set"}, admin); !errors.Is(err, ErrInvalidArg) {
+		t.Error("expected invalid permission error")
+	}
+
+	// admins can unshare
+	if _, err := client.Share(o.UID, types.ACLGroupPrefix+"team", nil, admin); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Get(o.UID, teammate); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error after unsharing")
+	}
+
+	// writes without a user keep the access control list
+	stored, _ := client.Get(o.UID, nil)
+	client.Set(&types.Object{UID: o.UID, Data: stored.Data}, nil)
+	if _, err := client.Get(o.UID, friend); err != nil {
+		t.Error(err)
+	}
+}
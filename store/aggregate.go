@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	aggCount = "count"
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+)
+
+var aggregateRegex = regexp.MustCompile(`^([a-zA-Z]+)\s*(?:\(\s*([^()\s]*)\s*\))?$`)
+
+// aggregateFunc is a single aggregate function to compute over a field.
+type aggregateFunc struct {
+	Name  string // name of the result, i.e. 'sum(views)'
+	Func  string
+	Field string
+}
+
+// aggregateGroup holds the running aggregate values of a group.
+type aggregateGroup struct {
+	values  []interface{}
+	count   int
+	sums    []float64
+	counts  []int
+	extreme []interface{}
+}
+
+func parseAggregates(aggregates []string) ([]aggregateFunc, error) {
+	out := make([]aggregateFunc, 0)
+	for _, aggregate := range aggregates {
+		m := aggregateRegex.FindStringSubmatch(strings.TrimSpace(aggregate))
+		if m == nil {
+			return nil, errors.WithStack(ErrInvalidArg)
+		}
+		// function names are case insensitive, field names are not
+		fn := aggregateFunc{Func: strings.ToLower(m[1]), Field: m[2]}
+		switch fn.Func {
+		case aggCount:
+			{
+				if fn.Field == "*" {
+					fn.Field = ""
+				}
+				break
+			}
+		case aggSum, aggAvg, aggMin, aggMax:
+			{
+				if fn.Field == "" {
+					return nil, errors.WithStack(ErrInvalidArg)
+				}
+				break
+			}
+		default:
+			{
+				return nil, errors.WithStack(ErrInvalidArg)
+			}
+		}
+		fn.Name = fn.Func
+		if fn.Field != "" {
+			fn.Name += "(" + fn.Field + ")"
+		}
+		out = append(out, fn)
+	}
+	return out, nil
+}
+
+func (g *aggregateGroup) add(funcs []aggregateFunc, queryMap map[string]interface{}) {
+	g.count++
+	for i, fn := range funcs {
+		if fn.Field == "" {
+			continue
+		}
+		v, exists := queryMap[fn.Field]
+		if !exists {
+			continue
+		}
+		switch fn.Func {
+		case aggCount:
+			{
+				g.counts[i]++
+				break
+			}
+		case aggSum, aggAvg:
+			{
+				if sortValueRank(v) == 1 {
+					g.sums[i] += sortValueFloat(v)
+					g.counts[i]++
+				}
+				break
+			}
+		case aggMin:
+			{
+				if g.extreme[i] == nil || compareSortValues(v, g.extreme[i]) < 0 {
+					g.extreme[i] = v
+				}
+				break
+			}
+		case aggMax:
+			{
+				if g.extreme[i] == nil || compareSortValues(v, g.extreme[i]) > 0 {
+					g.extreme[i] = v
+				}
+				break
+			}
+		}
+	}
+}
+
+func (g *aggregateGroup) API(groupBy []string, funcs []aggregateFunc) types.APIObject {
+	out := make(types.APIObject)
+	for i, field := range groupBy {
+		out[field] = g.values[i]
+	}
+	for i, fn := range funcs {
+		switch fn.Func {
+		case aggCount:
+			{
+				out[fn.Name] = g.count
+				if fn.Field != "" {
+					out[fn.Name] = g.counts[i]
+				}
+				break
+			}
+		case aggSum:
+			{
+				out[fn.Name] = g.sums[i]
+				break
+			}
+		case aggAvg:
+			{
+				out[fn.Name] = nil
+				if g.counts[i] > 0 {
+					out[fn.Name] = g.sums[i] / float64(g.counts[i])
+				}
+				break
+			}
+		case aggMin, aggMax:
+			{
+				out[fn.Name] = g.extreme[i]
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Aggregate computes aggregate functions, i.e. 'count' or 'sum(views)', over the
+// indexed objects that match query, grouped by the values of the given fields.
+func (c *Client) Aggregate(q string, groupBy []string, aggregates []string, u *types.User) ([]types.APIObject, error) {
+	out, err := c.AggregateContext(context.Background(), q, groupBy, aggregates, u)
+	return out, errors.WithStack(err)
+}
+
+// AggregateContext is Aggregate that stops evaluating the query when ctx is done.
+func (c *Client) AggregateContext(ctx context.Context, q string, groupBy []string, aggregates []string, u *types.User) ([]types.APIObject, error) {
+	if len(aggregates) == 0 {
+		aggregates = []string{aggCount}
+	}
+	funcs, err := parseAggregates(aggregates)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := c.checkRawQuery(u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	matches, err := c.match(ctx, q, u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	groups := make(map[string]*aggregateGroup)
+	for _, obj := range matches {
+		queryMap := obj.QueryMap()
+		values := make([]interface{}, 0, len(groupBy))
+		for _, field := range groupBy {
+			values = append(values, queryMap[field])
+		}
+		rawKey, err := json.Marshal(values)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		group := groups[string(rawKey)]
+		if group == nil {
+			group = &aggregateGroup{
+				values:  values,
+				sums:    make([]float64, len(funcs)),
+				counts:  make([]int, len(funcs)),
+				extreme: make([]interface{}, len(funcs)),
+			}
+			groups[string(rawKey)] = group
+		}
+		group.add(funcs, queryMap)
+	}
+	// order groups by their values
+	sorts := make([]querySort, 0, len(groupBy))
+	for _, field := range groupBy {
+		sorts = append(sorts, querySort{Field: field})
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareSortKeys(sorts, groups[keys[i]].values, keys[i], groups[keys[j]].values, keys[j]) < 0
+	})
+	out := make([]types.APIObject, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, groups[k].API(groupBy, funcs))
+	}
+	return out, nil
+}
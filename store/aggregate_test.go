@@ -0,0 +1,67 @@
+package store
+
+import (
+	"testing"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestAggregate(t *testing.T) {
+	client := NewClient(nil)
+	for i := 0; i < 10; i++ {
+		objType := "page"
+		if i%2 == 0 {
+			objType = "post"
+		}
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"type":  objType,
+				"views": i,
+			},
+		}, nil)
+	}
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "page"}}, nil)
+
+	res, err := client.Aggregate("views >= 0", []string{"type"}, []string{"count", "sum(views)", "min(views)", "max(views)"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 2 {
+		t.Error("expected two groups")
+		return
+	}
+	if res[0]["type"] != "page" || res[0]["count"] != 5 || res[0]["sum(views)"] != float64(25) ||
+		res[0]["min(views)"] != float64(1) || res[0]["max(views)"] != float64(9) {
+		t.Error("unexpected page aggregate")
+	}
+	if res[1]["type"] != "post" || res[1]["count"] != 5 || res[1]["sum(views)"] != float64(20) {
+		t.Error("unexpected post aggregate")
+	}
+
+	// count of field only counts objects that have it
+	res, err = client.Aggregate("type = 'page'", nil, []string{"count", "count(views)", "avg(views)"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0]["count"] != 6 || res[0]["count(views)"] != 5 || res[0]["avg(views)"] != float64(5) {
+		t.Error("unexpected aggregate")
+	}
+
+	if _, err := client.Aggregate("type = 'page'", nil, []string{"median(views)"}, nil); err == nil {
+		t.Error("expected invalid aggregate error")
+	}
+
+	// field names keep their case, function names don't
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "stat", "pageViews": 3}}, nil)
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "stat", "pageViews": 4}}, nil)
+	res, err = client.Aggregate("type = 'stat'", nil, []string{"SUM(pageViews)"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0]["sum(pageViews)"] != float64(7) {
+		t.Error("unexpected mixed case field aggregate")
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// hybridClock issues hybrid logical clock timestamps for writes. Timestamps seen in the
+// store advance the clock so later local writes are ordered after them.
+type hybridClock struct {
+	lock sync.Mutex
+	now  func() time.Time
+	node string
+	last types.HLC
+}
+
+func newHybridClock(now func() time.Time) *hybridClock {
+	return &hybridClock{
+		now:  now,
+		node: generateObjectUID(),
+	}
+}
+
+// time returns the physical time.
+func (h *hybridClock) time() time.Time {
+	return h.now()
+}
+
+// stamp returns a timestamp after every timestamp issued or observed by the clock.
+func (h *hybridClock) stamp() types.HLC {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	wall := h.now().UnixNano()
+	if wall > h.last.Wall {
+		h.last = types.HLC{Wall: wall, Node: h.node}
+		return h.last
+	}
+	h.last.Logical++
+	h.last.Node = h.node
+	return h.last
+}
+
+// observe advances the clock past a timestamp written by another client.
+func (h *hybridClock) observe(remote types.HLC) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if remote.Wall > h.last.Wall || (remote.Wall == h.last.Wall && remote.Logical > h.last.Logical) {
+		h.last.Wall = remote.Wall
+		h.last.Logical = remote.Logical
+	}
+}
+
+// SetClock replaces the function returning the current time used to stamp writes.
+func (c *Client) SetClock(now func() time.Time) {
+	c.clock.lock.Lock()
+	defer c.clock.lock.Unlock()
+	c.clock.now = now
+}
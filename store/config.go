@@ -6,10 +6,9 @@ import (
 	"github.com/philippgille/gokv/file"
 	"github.com/philippgille/gokv/redis"
 
-	"github.com/philippgille/gokv/syncmap"
-
 	"github.com/philippgille/gokv"
 	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
 	"gopkg.in/yaml.v3"
 )
 
@@ -22,7 +21,13 @@ type Config struct {
 		Type   string                 `yaml:"type"`
 		Config map[string]interface{} `yaml:"config"`
 	} `yaml:"storage"`
-	UserGroups map[string]UserGroup `yaml:"user_groups"`
+	UserGroups map[string]UserGroup         `yaml:"user_groups"`
+	Search     SearchConfig                 `yaml:"search"`
+	Index      map[string]types.IndexConfig `yaml:"index"`         // index config by object type, 'default' applies to every other type
+	SlowQuery  int                          `yaml:"slow_query_ms"` // log queries that take longer than this many milliseconds, zero to disable
+	Queries    map[string]SavedQuery        `yaml:"queries"`       // saved queries by name
+	Sync       SyncConfig                   `yaml:"sync"`
+	RateLimit  RateLimitConfig              `yaml:"rate_limit"`
 }
 
 // LoadConfig loads config file.
@@ -55,10 +60,10 @@ func (c *Config) storageClient() gokv.Store {
 			if c.Storage.Config["password"] != nil {
 				opts.Password = c.Storage.Config["password"].(string)
 			}
-			client, err := redis.NewClient(opts)
+			client, err := newRedisStore(opts)
 			if err != nil {
 				logWarnErr(err, "redis client error")
-				return syncmap.NewStore(syncmap.DefaultOptions)
+				return newMemoryStore()
 			}
 			return client
 		}
@@ -69,17 +74,17 @@ func (c *Config) storageClient() gokv.Store {
 			if c.Storage.Config["path"] != nil {
 				opts.Directory = c.Storage.Config["path"].(string)
 			}
-			client, err := file.NewStore(opts)
+			client, err := newFileStore(opts)
 			if err != nil {
 				logWarnErr(err, "file client error")
-				return syncmap.NewStore(syncmap.DefaultOptions)
+				return newMemoryStore()
 			}
 			return client
 		}
 	default:
 		{
 			// defaults to memory map
-			return syncmap.NewStore(syncmap.DefaultOptions)
+			return newMemoryStore()
 		}
 	}
 }
@@ -17,4 +17,12 @@ var (
 	ErrInvalidPassword     = errors.New("invalid password, cannot be empty or less than eight characters")
 	ErrUnknown             = errors.New("an unknown error has occured")
 	ErrInvalidUsername     = errors.New("invalid or missing username")
+	ErrNotSupported        = errors.New("operation not supported by storage backend")
+	ErrInvalidCursor       = errors.New("invalid query cursor")
+	ErrInvalidQuery        = errors.New("invalid query")
+	ErrQueryLimit          = errors.New("query exceeds the limits of the user group")
+	ErrQueryTimeout        = errors.New("query timed out")
+	ErrRateLimit           = errors.New("rate limit exceeded")
+	ErrQuota               = errors.New("storage quota exceeded")
+	ErrConflict            = errors.New("resource was changed by another client")
 )
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	readOnlyReject = "reject"
+	readOnlyIgnore = "ignore"
+)
+
+// fieldRules are the field level permissions of a user. As with object permissions the
+// most permissive of the user's groups applies, a field is only hidden or read only when
+// it is in every group.
+type fieldRules struct {
+	hidden   []string
+	readOnly []string
+	ignore   bool // ignore writes to read only fields instead of rejecting them
+}
+
+func (c *Client) getFieldRules(u *types.User) fieldRules {
+	userGroups := c.getUserGroups(u)
+	if len(userGroups) == 0 {
+		return fieldRules{}
+	}
+	out := fieldRules{
+		hidden:   userGroups[0].HiddenFields,
+		readOnly: append(append([]string{}, userGroups[0].ReadOnlyFields...), userGroups[0].HiddenFields...),
+		ignore:   true,
+	}
+	for _, userGroup := range userGroups[1:] {
+		out.hidden = intersectFields(out.hidden, userGroup.HiddenFields)
+		out.readOnly = intersectFields(out.readOnly, append(append([]string{}, userGroup.ReadOnlyFields...), userGroup.HiddenFields...))
+	}
+	for _, userGroup := range userGroups {
+		if userGroup.ReadOnlyMode != readOnlyIgnore {
+			out.ignore = false
+		}
+	}
+	return out
+}
+
+func intersectFields(a []string, b []string) []string {
+	out := make([]string, 0)
+	for _, field := range a {
+		for _, other := range b {
+			if field == other {
+				out = append(out, field)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (r fieldRules) isHidden(field string) bool {
+	for _, hidden := range r.hidden {
+		if hidden == field {
+			return true
+		}
+	}
+	return false
+}
+
+// strip returns object data without the hidden fields. Every way of reading objects goes
+// through it, the store has no change feed yet, one added later must strip its events too.
+func (r fieldRules) strip(data map[string]interface{}) map[string]interface{} {
+	if len(r.hidden) == 0 {
+		return data
+	}
+	data = copyData(data)
+	for _, field := range r.hidden {
+		deleteDataValue(data, field)
+	}
+	return data
+}
+
+// stripIndex returns index object without the hidden fields, so they can't be queried or sorted on.
+func (r fieldRules) stripIndex(o *types.IndexObject) *types.IndexObject {
+	if len(r.hidden) == 0 {
+		return o
+	}
+	out := *o
+	out.Data = make(map[string]interface{}, len(o.Data))
+	for k, v := range o.Data {
+		hidden := false
+		for _, field := range r.hidden {
+			if k == field || strings.HasPrefix(k, field+".") {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			out.Data[k] = v
+		}
+	}
+	return &out
+}
+
+// checkWrite enforces the read only fields on object written over existing object, nil
+// for new objects. Hidden fields left out of the write keep their existing value.
+func (r fieldRules) checkWrite(o *types.Object, existing *types.Object) error {
+	if len(r.readOnly) == 0 {
+		return nil
+	}
+	var existingData map[string]interface{}
+	if existing != nil {
+		existingData = existing.Data
+	}
+	data := copyData(o.Data)
+	for _, field := range r.readOnly {
+		v, exists := dataValue(data, field)
+		old, oldExists := dataValue(existingData, field)
+		if exists == oldExists && (!exists || sameValue(v, old)) {
+			continue
+		}
+		if exists || !r.isHidden(field) {
+			if !r.ignore {
+				return errors.Wrapf(ErrPermission, "field %s is read only", field)
+			}
+		}
+		if oldExists {
+			setDataValue(data, field, old)
+			continue
+		}
+		deleteDataValue(data, field)
+	}
+	o.Data = data
+	return nil
+}
+
+// sameValue returns true if values encode to the same JSON, so numbers of different types compare equal.
+func sameValue(a interface{}, b interface{}) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(rawA) == string(rawB)
+}
+
+// copyData returns a copy of data with its nested maps and arrays copied.
+func copyData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+// copyValue returns a copy of v when it's a map or array.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		{
+			return copyData(v)
+		}
+	case []interface{}:
+		{
+			out := make([]interface{}, len(v))
+			for i, item := range v {
+				out[i] = copyValue(item)
+			}
+			return out
+		}
+	}
+	return v
+}
+
+// dataValue returns the value at dot path of data.
+func dataValue(data map[string]interface{}, field string) (interface{}, bool) {
+	segments := strings.Split(field, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := data[segment].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data = nested
+	}
+	v, exists := data[segments[len(segments)-1]]
+	return v, exists
+}
+
+// setDataValue sets the value at dot path of data, creating the maps along the path.
+func setDataValue(data map[string]interface{}, field string, v interface{}) {
+	segments := strings.Split(field, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := data[segment].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			data[segment] = nested
+		}
+		data = nested
+	}
+	data[segments[len(segments)-1]] = v
+}
+
+// deleteDataValue removes the value at dot path of data, paths through arrays remove it
+// from every object in the array.
+func deleteDataValue(data map[string]interface{}, field string) {
+	segments := strings.SplitN(field, ".", 2)
+	if len(segments) == 1 {
+		delete(data, field)
+		return
+	}
+	deleteNestedValue(data[segments[0]], segments[1])
+}
+
+// deleteNestedValue removes the value at dot path of a nested map or of the objects in an array.
+func deleteNestedValue(v interface{}, field string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		{
+			deleteDataValue(v, field)
+			break
+		}
+	case []interface{}:
+		{
+			for _, item := range v {
+				deleteNestedValue(item, field)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestFieldPermissions(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"anonymous": {Get: true, HiddenFields: []string{"email", "address.street"}},
+			"editor":    {Get: true, Set: true, Update: true, ReadOnlyFields: []string{"status"}},
+			"lenient":   {Get: true, Set: true, Update: true, ReadOnlyFields: []string{"status"}, ReadOnlyMode: readOnlyIgnore},
+			"admin":     {Get: true, Set: true, Update: true},
+		},
+	})
+	admin := &types.User{UID: "admin", Groups: []string{"admin"}}
+	anonymous := &types.User{UID: "anonymous", Groups: []string{"anonymous"}}
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	o := &types.Object{Data: map[string]interface{}{
+		"type":    "person",
+		"name":    "Alice",
+		"email":   "alice@example.com",
+		"status":  "draft",
+		"address": map[string]interface{}{"city": "Lyon", "street": "Rue de la République"},
+	}}
+	if err := client.Set(o, admin); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// hidden fields are stripped from get and query results and can't be queried
+	got, err := client.Get(o.UID, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, exists := got.Data["email"]; exists || got.Data["address"].(map[string]interface{})["street"] != nil {
+		t.Error("expected hidden fields to be stripped")
+	}
+	if got.Data["address"].(map[string]interface{})["city"] != "Lyon" {
+		t.Error("expected visible nested field")
+	}
+	res, err := client.QueryWithOptions("type = 'person'", types.QueryOptions{Full: true}, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 1 || res.Objects[0].Data["email"] != nil || res.Objects[0].Data["address.street"] != nil || res.Full[0].Data["email"] != nil {
+		t.Error("expected hidden fields to be stripped from query results")
+	}
+	if res, _ := client.Query("email = 'alice@example.com'", anonymous); len(res) != 0 {
+		t.Error("expected hidden field not to be queryable")
+	}
+	if res, _ := client.Query("email = 'alice@example.com'", admin); len(res) != 1 {
+		t.Error("expected admin to query every field")
+	}
+
+	// read only fields are rejected, or ignored when configured
+	got, _ = client.Get(o.UID, editor)
+	got.Data["name"] = "Alice B."
+	if err := client.Set(got, editor); err != nil {
+		t.Error(err)
+	}
+	got.Data["status"] = "published"
+	if err := client.Set(got, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected read only field to be rejected")
+	}
+	if err := client.Set(&types.Object{Data: map[string]interface{}{"type": "person", "status": "published"}}, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected read only field to be rejected on new object")
+	}
+	lenient := &types.User{UID: "lenient", Groups: []string{"lenient"}}
+	got.Data["name"] = "Alice C."
+	if err := client.Set(got, lenient); err != nil {
+		t.Error(err)
+	}
+	stored, _ := client.Get(o.UID, nil)
+	if stored.Data["status"] != "draft" || stored.Data["name"] != "Alice C." {
+		t.Error("expected read only field to be ignored")
+	}
+	got.Data["status"] = "published"
+	if err := client.Set(got, admin); err != nil {
+		t.Error(err)
+	}
+
+	// writes by users who can't see hidden fields keep them
+	writer := &types.User{UID: "writer", Groups: []string{"anonymous", "editor"}}
+	if rules := client.getFieldRules(writer); len(rules.hidden) != 0 {
+		t.Error("expected hidden fields of one group to be visible through another")
+	}
+	client.userGroups["anonymous"] = UserGroup{Get: true, Update: true, HiddenFields: []string{"email"}}
+	got, _ = client.Get(o.UID, anonymous)
+	got.Data["name"] = "Alice D."
+	if err := client.Set(got, anonymous); err != nil {
+		t.Error(err)
+	}
+	if got.Data["email"] != nil {
+		t.Error("expected hidden field to be stripped after write")
+	}
+	stored, _ = client.Get(o.UID, nil)
+	if stored.Data["email"] != "alice@example.com" || stored.Data["name"] != "Alice D." {
+		t.Error("expected hidden field to be kept")
+	}
+	got.Data["email"] = "mallory@example.com"
+	if err := client.Set(got, anonymous); !errors.Is(err, ErrPermission) {
+		t.Error("expected hidden field write to be rejected")
+	}
+}
+
+func TestHiddenFieldsInArrays(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"anonymous": {Get: true, HiddenFields: []string{"items.secret"}},
+		},
+	})
+	anonymous := &types.User{UID: "anonymous", Groups: []string{"anonymous"}}
+	o := &types.Object{Data: map[string]interface{}{
+		"type": "order",
+		"items": []interface{}{
+			map[string]interface{}{"name": "first", "secret": "a"},
+			map[string]interface{}{"name": "second", "secret": "b"},
+		},
+	}}
+	if err := client.Set(o, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	got, err := client.Get(o.UID, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	items := got.Data["items"].([]interface{})
+	if len(items) != 2 || items[0].(map[string]interface{})["secret"] != nil || items[1].(map[string]interface{})["name"] != "second" {
+		t.Errorf("expected hidden field to be stripped from array objects, got %v", items)
+	}
+	res, err := client.QueryWithOptions("type = 'order'", types.QueryOptions{Full: true}, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Full) != 1 || res.Full[0].Data["items"].([]interface{})[1].(map[string]interface{})["secret"] != nil {
+		t.Error("expected hidden field to be stripped from full query results")
+	}
+
+	// stripping doesn't change the stored object
+	stored, _ := client.Get(o.UID, nil)
+	if stored.Data["items"].([]interface{})[0].(map[string]interface{})["secret"] != "a" {
+		t.Error("expected stored object to keep hidden field")
+	}
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	fsckOrphanedIndex = "orphaned_index"
+	fsckMissingIndex  = "missing_index"
+	fsckUsername      = "username_mismatch"
+	fsckUnknownGroup  = "unknown_group"
+)
+
+// FsckIssue is a consistency problem found in the store.
+type FsckIssue struct {
+	Type     string `json:"type"`
+	Key      string `json:"key"`
+	Message  string `json:"message"`
+	Repaired bool   `json:"repaired"`
+}
+
+// API converts fsck issue to API object.
+func (i *FsckIssue) API() types.APIObject {
+	return types.APIObject{
+		"type":     i.Type,
+		"key":      i.Key,
+		"message":  i.Message,
+		"repaired": i.Repaired,
+	}
+}
+
+// RebuildIndex regenerates the index and author usage from the stored objects and returns the number of indexed objects.
+func (c *Client) RebuildIndex() (int, error) {
+	keys, err := listKeys(c.store, objectPrefix)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer c.sync.Unlock()
+	c.sync.Lock()
+	index := make(map[string]*types.IndexObject)
+	shards := make(map[string]*indexShard)
+	usage := make(map[string]*Usage)
+	c.search.reset()
+	for _, key := range keys {
+		o := &types.Object{}
+		if err := c.getRaw(key, o); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return 0, errors.WithStack(err)
+		}
+		indexObj := c.indexObject(o)
+		index[o.UID] = indexObj
+		c.search.set(o)
+		shardKey := indexShardKey(o.UID)
+		if shards[shardKey] == nil {
+			shards[shardKey] = &indexShard{Objects: make(map[string]*types.IndexObject)}
+		}
+		shards[shardKey].Objects[o.UID] = indexObj
+		if o.Author != "" {
+			if usage[o.Author] == nil {
+				usage[o.Author] = &Usage{UID: o.Author}
+			}
+			usage[o.Author].Objects++
+			usage[o.Author].Bytes += objectSize(o)
+		}
+	}
+	if err := c.replaceUsage(usage); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	// replace every shard, removing the ones left empty
+	c.shardSync.Lock()
+	for _, shardKey := range indexShardKeys() {
+		if shards[shardKey] == nil {
+			err = c.store.Delete(shardKey)
+		} else {
+			err = c.store.Set(shardKey, shards[shardKey])
+		}
+		if err != nil {
+			c.shardSync.Unlock()
+			return 0, errors.WithStack(err)
+		}
+	}
+	if err := c.bumpIndexVersions(indexShardKeys()...); err != nil {
+		c.shardSync.Unlock()
+		return 0, errors.WithStack(err)
+	}
+	c.shardSync.Unlock()
+	c.indexSync.Lock()
+	c.setIndex(index)
+	c.indexSync.Unlock()
+	return len(index), nil
+}
+
+// Fsck checks the store for inconsistencies between objects, the index, users and user groups.
+// When repair is true the issues found are fixed.
+func (c *Client) Fsck(repair bool) ([]FsckIssue, error) {
+	if err := c.Sync(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out := make([]FsckIssue, 0)
+	issues, err := c.fsckIndex(repair)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out = append(out, issues...)
+	issues, err = c.fsckUsers(repair)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out = append(out, issues...)
+	return out, nil
+}
+
+func (c *Client) fsckIndex(repair bool) ([]FsckIssue, error) {
+	keys, err := listKeys(c.store, objectPrefix)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	index, err := c.Index()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out := make([]FsckIssue, 0)
+	stored := make(map[string]bool)
+	for _, key := range keys {
+		stored[strings.TrimPrefix(key, objectPrefix)] = true
+	}
+	indexed := make(map[string]bool)
+	// index entries without an object
+	for _, o := range index {
+		indexed[o.UID] = true
+		if stored[o.UID] {
+			continue
+		}
+		issue := FsckIssue{
+			Type:    fsckOrphanedIndex,
+			Key:     indexShardKey(o.UID),
+			Message: fmt.Sprintf("index entry %s has no stored object", o.UID),
+		}
+		if repair {
+			c.deleteIndex(o.UID)
+			if err := c.commitIndexObject(o.UID, nil); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			issue.Repaired = true
+		}
+		out = append(out, issue)
+	}
+	// objects without an index entry
+	for _, key := range keys {
+		uid := strings.TrimPrefix(key, objectPrefix)
+		if indexed[uid] {
+			continue
+		}
+		issue := FsckIssue{
+			Type:    fsckMissingIndex,
+			Key:     key,
+			Message: fmt.Sprintf("object %s is missing from the index", uid),
+		}
+		if repair {
+			o := &types.Object{}
+			if err := c.getRaw(key, o); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			indexObj := c.indexObject(o)
+			c.addIndex(indexObj)
+			if err := c.commitIndexObject(o.UID, indexObj); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			issue.Repaired = true
+		}
+		out = append(out, issue)
+	}
+	return out, nil
+}
+
+func (c *Client) fsckUsers(repair bool) ([]FsckIssue, error) {
+	out := make([]FsckIssue, 0)
+	// username keys that don't match their user record
+	usernameKeys, err := listKeys(c.store, usernamePrefix)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, key := range usernameKeys {
+		byUsername := &types.User{}
+		if err := c.getRaw(key, byUsername); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+		u, err := c.GetUser(byUsername.UID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, errors.WithStack(err)
+		}
+		issue := FsckIssue{Type: fsckUsername, Key: key}
+		switch {
+		case u == nil:
+			{
+				issue.Message = fmt.Sprintf("user %s does not exist", byUsername.UID)
+				if repair {
+					if err := c.store.Delete(key); err != nil {
+						return nil, errors.WithStack(err)
+					}
+					issue.Repaired = true
+				}
+			}
+		case usernamePrefix+u.Username != key || !usersEqual(u, byUsername):
+			{
+				issue.Message = fmt.Sprintf("username record disagrees with user %s", u.UID)
+				if repair {
+					if usernamePrefix+u.Username != key {
+						if err := c.store.Delete(key); err != nil {
+							return nil, errors.WithStack(err)
+						}
+					}
+					if err := c.store.Set(usernamePrefix+u.Username, u); err != nil {
+						return nil, errors.WithStack(err)
+					}
+					issue.Repaired = true
+				}
+			}
+		default:
+			{
+				continue
+			}
+		}
+		out = append(out, issue)
+	}
+	// user records missing a username key or belonging to unknown groups
+	userKeys, err := listKeys(c.store, userPrefix)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, key := range userKeys {
+		u := &types.User{}
+		if err := c.getRaw(key, u); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+		if err := c.getRaw(usernamePrefix+u.Username, &types.User{}); err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				return nil, errors.WithStack(err)
+			}
+			issue := FsckIssue{
+				Type:    fsckUsername,
+				Key:     usernamePrefix + u.Username,
+				Message: fmt.Sprintf("user %s has no username record", u.UID),
+			}
+			if repair {
+				if err := c.store.Set(usernamePrefix+u.Username, u); err != nil {
+					return nil, errors.WithStack(err)
+				}
+				issue.Repaired = true
+			}
+			out = append(out, issue)
+		}
+		groups := make([]string, 0)
+		for _, name := range u.Groups {
+			if _, exists := c.getUserGroupMap()[name]; exists {
+				groups = append(groups, name)
+				continue
+			}
+			out = append(out, FsckIssue{
+				Type:     fsckUnknownGroup,
+				Key:      key,
+				Message:  fmt.Sprintf("user %s belongs to group %s which is not configured", u.UID, name),
+				Repaired: repair,
+			})
+		}
+		if repair && len(groups) != len(u.Groups) {
+			u.Groups = groups
+			if err := c.SetUser(u); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+	return out, nil
+}
+
+func usersEqual(a *types.User, b *types.User) bool {
+	if a.UID != b.UID || a.Username != b.Username || a.PasswordHash != b.PasswordHash ||
+		a.Active != b.Active || len(a.Groups) != len(b.Groups) {
+		return false
+	}
+	for i := range a.Groups {
+		if a.Groups[i] != b.Groups[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"testing"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestRebuildIndex(t *testing.T) {
+	client := NewClient(nil)
+	for i := 0; i < 16; i++ {
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"test_int": i,
+			},
+		}, nil)
+	}
+	// lose the index
+	for _, key := range indexShardKeys() {
+		client.store.Delete(key)
+	}
+	client.setIndex(map[string]*types.IndexObject{})
+	res, _ := client.Query("test_int >= 0", nil)
+	if len(res) != 0 {
+		t.Error("expected empty index")
+		return
+	}
+	count, err := client.RebuildIndex()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if count != 16 {
+		t.Error("unexpected rebuilt index size")
+		return
+	}
+	client2 := NewClient(nil)
+	client2.store = client.store
+	client2.Sync()
+	res, _ = client2.Query("test_int >= 0", nil)
+	if len(res) != 16 {
+		t.Error("expected rebuilt index to be persisted")
+	}
+}
+
+func TestFsck(t *testing.T) {
+	c := &Config{}
+	c.UserGroups = map[string]UserGroup{
+		"admin": UserGroup{Get: true},
+	}
+	client := NewClient(c)
+
+	// object missing from index
+	o := &types.Object{UID: "missing", Data: map[string]interface{}{"test": "hello"}}
+	client.store.Set(objectPrefix+o.UID, o)
+	// index entry without object
+	orphan := &types.Object{UID: "orphan"}
+	client.addIndex(orphan.Index())
+	client.commitIndexObject(orphan.UID, orphan.Index())
+	// username record that disagrees with user record
+	u := &types.User{Username: "testuser", Groups: []string{"admin", "unknown"}}
+	client.SetUser(u)
+	stale := *u
+	stale.Active = false
+	client.store.Set(usernamePrefix+u.Username, &stale)
+
+	issues, err := client.Fsck(false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	found := make(map[string]int)
+	for _, issue := range issues {
+		if issue.Repaired {
+			t.Error("unexpected repaired issue")
+		}
+		found[issue.Type]++
+	}
+	for _, issueType := range []string{fsckOrphanedIndex, fsckMissingIndex, fsckUsername, fsckUnknownGroup} {
+		if found[issueType] != 1 {
+			t.Errorf("expected one %s issue", issueType)
+		}
+	}
+
+	// repair and check again
+	if _, err := client.Fsck(true); err != nil {
+		t.Error(err)
+		return
+	}
+	issues, err = client.Fsck(false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(issues) != 0 {
+		t.Errorf("expected no issues after repair, got %d", len(issues))
+	}
+	res, _ := client.Query("test = 'hello'", nil)
+	if len(res) != 1 {
+		t.Error("expected repaired object to be queryable")
+	}
+}
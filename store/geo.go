@@ -0,0 +1,281 @@
+package store
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	geoNear          = "near"
+	geoInside        = "inside"
+	geoDistanceField = "_distance"
+	// explainIndexGeo is the prefix of the explained index when the spatial index of a field is used
+	explainIndexGeo = "geo:"
+	// geoCellSize is the size in degrees of the cells of the spatial index grid
+	geoCellSize = 0.5
+	// geoKmPerDegree is the length of a degree of latitude
+	geoKmPerDegree = 111.32
+)
+
+type geoCell struct {
+	Lat int
+	Lng int
+}
+
+func geoCellOf(p types.GeoPoint) geoCell {
+	return geoCell{
+		Lat: int(math.Floor(p.Lat / geoCellSize)),
+		Lng: int(math.Floor(p.Lng / geoCellSize)),
+	}
+}
+
+// geoBox is a bounding box, boxes whose min longitude is greater than their max longitude cross the antimeridian.
+type geoBox struct {
+	Min types.GeoPoint
+	Max types.GeoPoint
+}
+
+func (b geoBox) contains(p types.GeoPoint) bool {
+	if p.Lat < b.Min.Lat || p.Lat > b.Max.Lat {
+		return false
+	}
+	if b.Min.Lng > b.Max.Lng {
+		return p.Lng >= b.Min.Lng || p.Lng <= b.Max.Lng
+	}
+	return p.Lng >= b.Min.Lng && p.Lng <= b.Max.Lng
+}
+
+// geoRadiusBox returns the bounding box of the circle of radius km around center.
+func geoRadiusBox(center types.GeoPoint, km float64) geoBox {
+	dLat := km / geoKmPerDegree
+	box := geoBox{
+		Min: types.GeoPoint{Lat: math.Max(-90, center.Lat-dLat), Lng: -180},
+		Max: types.GeoPoint{Lat: math.Min(90, center.Lat+dLat), Lng: 180},
+	}
+	// boxes reaching a pole span every longitude
+	if box.Min.Lat <= -90 || box.Max.Lat >= 90 {
+		return box
+	}
+	dLng := km / (geoKmPerDegree * math.Cos(center.Lat*math.Pi/180))
+	if dLng >= 180 {
+		return box
+	}
+	box.Min.Lng = center.Lng - dLng
+	box.Max.Lng = center.Lng + dLng
+	if box.Min.Lng < -180 {
+		box.Min.Lng += 360
+	}
+	if box.Max.Lng > 180 {
+		box.Max.Lng -= 360
+	}
+	return box
+}
+
+// geoIndex is an in memory grid of the geo points of indexed objects, it's guarded by the client index lock.
+type geoIndex struct {
+	fields map[string]map[geoCell]map[string]types.GeoPoint // field => cell => uid => point
+	counts map[string]int                                   // field => number of points
+	docs   map[string]map[string]geoCell                    // uid => field => cell
+}
+
+func newGeoIndex() *geoIndex {
+	return &geoIndex{
+		fields: make(map[string]map[geoCell]map[string]types.GeoPoint),
+		counts: make(map[string]int),
+		docs:   make(map[string]map[string]geoCell),
+	}
+}
+
+// set adds the geo points of index object, replacing its previous entries.
+func (g *geoIndex) set(o *types.IndexObject) {
+	g.delete(o.UID)
+	for field, v := range o.Data {
+		point, ok := types.ParseGeoPoint(v)
+		if !ok {
+			continue
+		}
+		cell := geoCellOf(point)
+		if g.fields[field] == nil {
+			g.fields[field] = make(map[geoCell]map[string]types.GeoPoint)
+		}
+		if g.fields[field][cell] == nil {
+			g.fields[field][cell] = make(map[string]types.GeoPoint)
+		}
+		g.fields[field][cell][o.UID] = point
+		g.counts[field]++
+		if g.docs[o.UID] == nil {
+			g.docs[o.UID] = make(map[string]geoCell)
+		}
+		g.docs[o.UID][field] = cell
+	}
+}
+
+// delete removes the geo points of object.
+func (g *geoIndex) delete(uid string) {
+	for field, cell := range g.docs[uid] {
+		delete(g.fields[field][cell], uid)
+		if len(g.fields[field][cell]) == 0 {
+			delete(g.fields[field], cell)
+		}
+		g.counts[field]--
+	}
+	delete(g.docs, uid)
+}
+
+// reset replaces the geo index with the points of the given index objects.
+func (g *geoIndex) reset(objs []*types.IndexObject) {
+	*g = *newGeoIndex()
+	for _, o := range objs {
+		g.set(o)
+	}
+}
+
+// candidates returns the uids of objects whose point at field is inside box.
+func (g *geoIndex) candidates(field string, box geoBox) []string {
+	out := make([]string, 0)
+	add := func(points map[string]types.GeoPoint) {
+		for uid, point := range points {
+			if box.contains(point) {
+				out = append(out, uid)
+			}
+		}
+	}
+	minCell, maxCell := geoCellOf(box.Min), geoCellOf(box.Max)
+	lngCells := maxCell.Lng - minCell.Lng + 1
+	if box.Min.Lng > box.Max.Lng {
+		lngCells += int(360 / geoCellSize)
+	}
+	// visiting more cells than there are points is slower than checking every point
+	if (maxCell.Lat-minCell.Lat+1)*lngCells > g.counts[field] {
+		for _, points := range g.fields[field] {
+			add(points)
+		}
+		return out
+	}
+	for lat := minCell.Lat; lat <= maxCell.Lat; lat++ {
+		for i := 0; i < lngCells; i++ {
+			lng := minCell.Lng + i
+			// wrap cells crossing the antimeridian
+			if lng >= int(180/geoCellSize) {
+				lng -= int(360 / geoCellSize)
+			}
+			add(g.fields[field][geoCell{Lat: lat, Lng: lng}])
+		}
+	}
+	return out
+}
+
+// queryGeo matches objects whose geo point at field is within a radius of a point or inside a bounding box.
+type queryGeo struct {
+	field  string
+	center *types.GeoPoint // set for radius queries
+	km     float64
+	box    geoBox
+}
+
+func newQueryGeoRadius(field string, center types.GeoPoint, km float64) (*queryGeo, error) {
+	if !validGeoPoint(center) || km < 0 {
+		return nil, errors.New("invalid radius")
+	}
+	return &queryGeo{
+		field:  field,
+		center: &center,
+		km:     km,
+		box:    geoRadiusBox(center, km),
+	}, nil
+}
+
+func newQueryGeoBox(field string, min types.GeoPoint, max types.GeoPoint) (*queryGeo, error) {
+	if !validGeoPoint(min) || !validGeoPoint(max) || min.Lat > max.Lat {
+		return nil, errors.New("invalid bounding box")
+	}
+	return &queryGeo{
+		field: field,
+		box:   geoBox{Min: min, Max: max},
+	}, nil
+}
+
+func validGeoPoint(p types.GeoPoint) bool {
+	_, ok := types.ParseGeoPoint(p.Map())
+	return ok
+}
+
+func (e *queryGeo) match(data map[string]interface{}) bool {
+	point, ok := types.ParseGeoPoint(data[e.field])
+	if !ok || !e.box.contains(point) {
+		return false
+	}
+	return e.center == nil || e.center.DistanceKm(point) <= e.km
+}
+
+func (e *queryGeo) tree() map[string]interface{} {
+	if e.center != nil {
+		return map[string]interface{}{
+			"field":  e.field,
+			"op":     geoNear,
+			"values": []interface{}{e.center.Lat, e.center.Lng, e.km},
+		}
+	}
+	return map[string]interface{}{
+		"field":  e.field,
+		"op":     geoInside,
+		"values": []interface{}{e.box.Min.Lat, e.box.Min.Lng, e.box.Max.Lat, e.box.Max.Lng},
+	}
+}
+
+// requiredGeo returns a geo condition that every match of expression must satisfy.
+func requiredGeo(expr queryExpr) *queryGeo {
+	switch e := expr.(type) {
+	case *queryGeo:
+		{
+			return e
+		}
+	case *queryAnd:
+		{
+			if g := requiredGeo(e.left); g != nil {
+				return g
+			}
+			return requiredGeo(e.right)
+		}
+	case *queryAll:
+		{
+			for _, child := range e.exprs {
+				if g := requiredGeo(child); g != nil {
+					return g
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// geoCandidates returns the index objects that may match geo condition in index order, must be called with the index lock held.
+func (c *Client) geoCandidates(g *queryGeo) []*types.IndexObject {
+	positions := make([]int, 0)
+	for _, uid := range c.geo.candidates(g.field, g.box) {
+		if i, exists := c.indexMap[uid]; exists {
+			positions = append(positions, i)
+		}
+	}
+	sort.Ints(positions)
+	out := make([]*types.IndexObject, 0, len(positions))
+	for _, i := range positions {
+		out = append(out, c.index[i])
+	}
+	return out
+}
+
+// geoDistances returns the distance in kilometers of each match from the center of a radius query.
+func geoDistances(g *queryGeo, matches []*types.IndexObject) map[string]float64 {
+	out := make(map[string]float64, len(matches))
+	for _, o := range matches {
+		if point, ok := types.ParseGeoPoint(o.Data[g.field]); ok {
+			out[o.UID] = g.center.DistanceKm(point)
+		}
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestQueryGeo(t *testing.T) {
+	client := NewClient(nil)
+	places := map[string]map[string]interface{}{
+		"lyon":         {"lat": 45.764, "lng": 4.8357},
+		"villeurbanne": {"lat": 45.7719, "lng": 4.8902},
+		"paris":        {"lat": 48.8566, "lng": 2.3522},
+		"fiji":         {"lat": -17.7134, "lng": 178.065},
+		"samoa":        {"lat": -13.759, "lng": -172.1046},
+	}
+	uids := make(map[string]string)
+	for name, location := range places {
+		o := &types.Object{Data: map[string]interface{}{"type": "place", "name": name, "location": location}}
+		if err := client.Set(o, nil); err != nil {
+			t.Error(err)
+			return
+		}
+		uids[o.UID] = name
+	}
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "place", "name": "nowhere"}}, nil)
+
+	names := func(res *QueryResult) map[string]bool {
+		out := make(map[string]bool)
+		for _, o := range res.Objects {
+			out[uids[o.UID]] = true
+		}
+		return out
+	}
+
+	// radius query sorted by distance
+	res, err := client.QueryWithOptions("near(location, 45.76, 4.85, 20) and type = 'place'", types.QueryOptions{Sort: []string{"-" + geoDistanceField}, Explain: true}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 2 || uids[res.Objects[0].UID] != "villeurbanne" {
+		t.Errorf("expected lyon and villeurbanne by descending distance, got %v", names(res))
+	}
+	if d := res.Distances[res.Objects[1].UID]; d <= 0 || d > 2 {
+		t.Errorf("unexpected distance %f", d)
+	}
+	if res.Explain.Index != explainIndexGeo+"location" || res.Explain.Scanned != 2 {
+		t.Errorf("unexpected explain %+v", res.Explain)
+	}
+
+	// bounding box crossing the antimeridian
+	res, err = client.QueryWithOptions("inside(location, -20, 170, -10, -170)", types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found := names(res); len(found) != 2 || !found["fiji"] || !found["samoa"] {
+		t.Errorf("expected fiji and samoa, got %v", found)
+	}
+
+	// geo conditions that aren't required use a full scan
+	res, err = client.QueryWithOptions("near(location, 48.85, 2.35, 10) or name = 'nowhere'", types.QueryOptions{Explain: true}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 2 || res.Explain.Index != explainIndexScan {
+		t.Errorf("unexpected result %v %+v", names(res), res.Explain)
+	}
+
+	// filter documents
+	res, err = client.QueryFilter(types.Filter{
+		"location": map[string]interface{}{"$box": map[string]interface{}{
+			"min": map[string]interface{}{"lat": 45.0, "lng": 2.0},
+			"max": map[string]interface{}{"lat": 49.0, "lng": 5.0},
+		}},
+		"name": map[string]interface{}{"$ne": "villeurbanne"},
+	}, types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found := names(res); len(found) != 2 || !found["lyon"] || !found["paris"] {
+		t.Errorf("expected lyon and paris, got %v", found)
+	}
+	res, err = client.QueryFilter(types.Filter{
+		"location": map[string]interface{}{"$near": map[string]interface{}{"lat": 48.86, "lon": 2.35, "km": 5}},
+	}, types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if found := names(res); len(found) != 1 || !found["paris"] {
+		t.Errorf("expected paris, got %v", found)
+	}
+
+	// moved and deleted objects leave the spatial index
+	for uid, name := range uids {
+		if name == "paris" {
+			client.Delete(&types.Object{UID: uid}, nil)
+		}
+	}
+	res, _ = client.QueryWithOptions("near(location, 48.85, 2.35, 10)", types.QueryOptions{}, nil)
+	if len(res.Objects) != 0 {
+		t.Error("expected deleted object not to match")
+	}
+
+	for _, q := range []string{"near(location, 45, 4)", "near(location, 95, 4, 1)", "inside(location, 10, 0, 0, 10)", "near(location.count(), 1, 1, 1)"} {
+		if _, err := parseQuery(q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected invalid query error", q)
+		}
+	}
+	if _, err := parseFilter(map[string]interface{}{"location": map[string]interface{}{"$near": map[string]interface{}{"lat": 1}}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("expected invalid filter error")
+	}
+}
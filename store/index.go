@@ -0,0 +1,243 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	indexShardPrefix = "index_"
+	indexShardCount  = 64
+	// indexConfigDefault is the index config applied to object types without their own config
+	indexConfigDefault = "default"
+)
+
+// indexShard is the persisted portion of the index holding all objects whose uid hashes to it.
+type indexShard struct {
+	Objects map[string]*types.IndexObject `json:"objects"`
+}
+
+func indexShardKey(uid string) string {
+	h := fnv.New32a()
+	h.Write([]byte(uid))
+	return fmt.Sprintf("%s%02x", indexShardPrefix, h.Sum32()%indexShardCount)
+}
+
+func indexShardKeys() []string {
+	out := make([]string, 0, indexShardCount)
+	for i := 0; i < indexShardCount; i++ {
+		out = append(out, fmt.Sprintf("%s%02x", indexShardPrefix, i))
+	}
+	return out
+}
+
+// indexObject returns the index of object using the index config of its type.
+func (c *Client) indexObject(o *types.Object) *types.IndexObject {
+	objType, _ := o.Data["type"].(string)
+	config, exists := c.indexConfig[objType]
+	if !exists {
+		config = c.indexConfig[indexConfigDefault]
+	}
+	return o.IndexWithConfig(config)
+}
+
+func (c *Client) getIndexShard(key string) (*indexShard, error) {
+	shard := &indexShard{}
+	if err := c.getRaw(key, shard); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	if shard.Objects == nil {
+		shard.Objects = make(map[string]*types.IndexObject)
+	}
+	return shard, nil
+}
+
+// commitIndexObject writes a single index entry to its shard, a nil entry removes it.
+func (c *Client) commitIndexObject(uid string, o *types.IndexObject) error {
+	c.shardSync.Lock()
+	defer c.shardSync.Unlock()
+	key := indexShardKey(uid)
+	// update the shard atomically so that changes made by other clients are kept
+	shard := &indexShard{}
+	changed := false
+	err := updateKey(c.store, key, shard, func(found bool) (updateAction, error) {
+		changed = false
+		if shard.Objects == nil {
+			shard.Objects = make(map[string]*types.IndexObject)
+		}
+		if o == nil {
+			if _, exists := shard.Objects[uid]; !exists {
+				return updateSkip, nil
+			}
+			delete(shard.Objects, uid)
+		} else {
+			// keep the entry of a newer write by another client, as sync does
+			if existing := shard.Objects[uid]; existing != nil && newerIndexObject(existing, o) {
+				return updateSkip, nil
+			}
+			shard.Objects[uid] = o
+		}
+		changed = true
+		if len(shard.Objects) == 0 {
+			return updateDelete, nil
+		}
+		return updateSet, nil
+	})
+	if err != nil || !changed {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(c.bumpIndexVersions(key))
+}
+
+// loadRemoteIndex reads every index shard from the store.
+func (c *Client) loadRemoteIndex() (map[string]*types.IndexObject, error) {
+	out := make(map[string]*types.IndexObject)
+	for _, key := range indexShardKeys() {
+		shard, err := c.getIndexShard(key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for uid, o := range shard.Objects {
+			out[uid] = o
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	// migrate index stored in the single legacy key
+	legacyIndex := make([]*types.IndexObject, 0)
+	if err := c.getRaw(indexName, &legacyIndex); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return out, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	for _, o := range legacyIndex {
+		out[o.UID] = o
+		if err := c.commitIndexObject(o.UID, o); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := c.store.Delete(indexName); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// setIndex replaces the local memory index with the given index objects.
+func (c *Client) setIndex(objs map[string]*types.IndexObject) {
+	c.index = make([]*types.IndexObject, 0, len(objs))
+	for _, o := range objs {
+		c.index = append(c.index, o)
+	}
+	sort.Slice(c.index, func(i, j int) bool {
+		if c.index[i].Created.Equal(c.index[j].Created) {
+			return c.index[i].UID < c.index[j].UID
+		}
+		return c.index[i].Created.Before(c.index[j].Created)
+	})
+	c.indexMap = make(map[string]int, len(c.index))
+	for i, o := range c.index {
+		c.indexMap[o.UID] = i
+	}
+	c.geo.reset(c.index)
+}
+
+func (c *Client) addIndex(o *types.IndexObject) {
+	c.indexSync.Lock()
+	defer c.indexSync.Unlock()
+	c.geo.set(o)
+	if i, exists := c.indexMap[o.UID]; exists {
+		c.index[i] = o
+		return
+	}
+	c.indexMap[o.UID] = len(c.index)
+	c.index = append(c.index, o)
+}
+
+func (c *Client) deleteIndex(uid string) {
+	c.indexSync.Lock()
+	defer c.indexSync.Unlock()
+	i, exists := c.indexMap[uid]
+	if !exists {
+		return
+	}
+	c.geo.delete(uid)
+	c.index = append(c.index[:i], c.index[i+1:]...)
+	delete(c.indexMap, uid)
+	for ; i < len(c.index); i++ {
+		c.indexMap[c.index[i].UID] = i
+	}
+}
+
+// Sync syncs the user groups and local memory index with the remote store.
+func (c *Client) Sync() error {
+	if err := c.loadUserGroups(); err != nil {
+		c.syncFailed()
+		return errors.WithStack(err)
+	}
+	if err := c.syncAll(); err != nil {
+		c.syncFailed()
+		return errors.WithStack(err)
+	}
+	c.syncDone(indexShardCount)
+	return nil
+}
+
+func (c *Client) syncAll() error {
+	// versions are read first so shards changed while loading are reloaded by the next sync
+	versions, err := c.getIndexVersions()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	remoteIndex, err := c.loadRemoteIndex()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.indexSync.Lock()
+	// track items changed by other clients so the search index can be updated
+	changed := make([]string, 0)
+	for uid, remoteIndexItem := range remoteIndex {
+		c.clock.observe(remoteIndexItem.HLC)
+		i, exists := c.indexMap[uid]
+		if !exists || newerIndexObject(remoteIndexItem, c.index[i]) {
+			changed = append(changed, uid)
+		}
+	}
+	// local items that are newer than, or missing from, the remote index are restored from the stored object
+	commit := make([]string, 0)
+	for _, localIndexItem := range c.index {
+		remoteIndexItem := remoteIndex[localIndexItem.UID]
+		if remoteIndexItem == nil || newerIndexObject(localIndexItem, remoteIndexItem) {
+			commit = append(commit, localIndexItem.UID)
+		}
+	}
+	c.setIndex(remoteIndex)
+	c.shardVersions = make(map[string]string, len(versions))
+	for key, v := range versions {
+		c.shardVersions[key] = v.Version
+	}
+	c.indexSync.Unlock()
+	for _, uid := range commit {
+		if err := c.restoreIndexObject(uid); err != nil {
+			return errors.WithStack(err)
+		}
+		changed = append(changed, uid)
+	}
+	return errors.WithStack(c.reindexSearch(changed))
+}
+
+// Index returns index data.
+func (c *Client) Index() ([]types.IndexObject, error) {
+	c.indexSync.Lock()
+	defer c.indexSync.Unlock()
+	out := make([]types.IndexObject, 0, len(c.index))
+	for _, o := range c.index {
+		out = append(out, *o)
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	permStepTrusted = "trusted" // no user, i.e. the CLI
+	permStepDeny    = "deny"    // deny rule of a group
+	permStepAuthor  = "author"  // author shortcut, authors can get their objects and update and delete them with 'set' permission
+	permStepGroup   = "group"   // allow rule of a group
+	permStepACL     = "acl"     // access control list of the object
+)
+
+// PermissionStep is a rule evaluated by a permission check.
+type PermissionStep struct {
+	Permission string
+	Check      string // trusted, deny, author, group or acl
+	Group      string // group of deny and allow rules
+	Rule       interface{}
+	Result     bool
+}
+
+// PermissionExplain describes how a permission check was decided.
+type PermissionExplain struct {
+	Permission string
+	UID        string
+	User       string
+	Allowed    bool
+	Steps      []PermissionStep
+}
+
+func (e *PermissionExplain) step(perm string, check string, group string, rule interface{}, result bool) {
+	if e == nil {
+		return
+	}
+	e.Steps = append(e.Steps, PermissionStep{Permission: perm, Check: check, Group: group, Rule: rule, Result: result})
+}
+
+// API converts permission explain to API object.
+func (e *PermissionExplain) API() types.APIObject {
+	steps := make([]interface{}, 0, len(e.Steps))
+	for _, step := range e.Steps {
+		out := map[string]interface{}{
+			"permission": step.Permission,
+			"check":      step.Check,
+			"result":     step.Result,
+		}
+		if step.Group != "" {
+			out["group"] = step.Group
+		}
+		if step.Rule != nil {
+			out["rule"] = step.Rule
+		}
+		steps = append(steps, out)
+	}
+	return types.APIObject{
+		"permission": e.Permission,
+		"uid":        e.UID,
+		"user":       e.User,
+		"allowed":    e.Allowed,
+		"steps":      steps,
+	}
+}
+
+// ExplainPermission checks whether the rules of user allow perm on the stored object of uid and
+// reports each rule evaluated. For update this is only the check Set makes against the stored
+// object, the data, read only fields and access control list of a write aren't known so they
+// aren't checked. Set of an existing object is an update, so it's explained as one. Only admins
+// can explain.
+func (c *Client) ExplainPermission(perm string, uid string, user *types.User, u *types.User) (*PermissionExplain, error) {
+	if !c.IsAdmin(u) {
+		return nil, errors.WithStack(ErrPermission)
+	}
+	if !validPermType(perm) {
+		return nil, errors.Wrapf(ErrInvalidArg, "invalid permission %s", perm)
+	}
+	if user == nil {
+		return nil, errors.WithStack(ErrInvalidUsername)
+	}
+	o := &types.Object{}
+	if err := c.getRaw(objectPrefix+uid, o); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if perm == permSet {
+		perm = permUpdate
+	}
+	out := &PermissionExplain{
+		Permission: perm,
+		UID:        uid,
+		User:       user.UID,
+		Steps:      make([]PermissionStep, 0),
+	}
+	err := c.explainPermission(perm, user, c.indexObject(o), out)
+	if err != nil && !errors.Is(err, ErrPermission) {
+		return nil, errors.WithStack(err)
+	}
+	out.Allowed = err == nil
+	return out, nil
+}
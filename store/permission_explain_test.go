@@ -0,0 +1,81 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestExplainPermission(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"staff":  {Get: "type = 'page'", Set: true},
+			"editor": {Inherits: []string{"staff"}, Deny: map[string]interface{}{permGet: "secret = true"}},
+			"admin":  {Admin: true},
+		},
+	})
+	author := &types.User{UID: "author", Groups: []string{"staff"}}
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	admin := &types.User{UID: "admin", Groups: []string{"admin"}}
+	objs := []*types.Object{
+		{Data: map[string]interface{}{"type": "page"}},
+		{Data: map[string]interface{}{"type": "page", "secret": true}},
+		{Data: map[string]interface{}{"type": "doc"}},
+	}
+	for _, o := range objs {
+		if err := client.Set(o, author); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := client.ExplainPermission(permGet, objs[0].UID, editor, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected only admins to explain permissions")
+	}
+
+	// decision is the same as get and update
+	for _, u := range []*types.User{author, editor} {
+		for _, o := range objs {
+			explain, err := client.ExplainPermission(permGet, o.UID, u, admin)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := client.Get(o.UID, u); explain.Allowed != (err == nil) {
+				t.Errorf("explain of get %s by %s differs from get", o.Data, u.UID)
+			}
+			explain, err = client.ExplainPermission(permUpdate, o.UID, u, admin)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := client.Set(&types.Object{UID: o.UID, Author: o.Author, Data: o.Data}, u); explain.Allowed != (err == nil) {
+				t.Errorf("explain of update %s by %s differs from set", o.Data, u.UID)
+			}
+		}
+	}
+
+	// steps report the group, rule and shortcuts
+	explain, _ := client.ExplainPermission(permGet, objs[1].UID, editor, admin)
+	if explain.Allowed || len(explain.Steps) != 1 || explain.Steps[0].Check != permStepDeny || explain.Steps[0].Group != "editor" {
+		t.Errorf("unexpected steps %+v", explain.Steps)
+	}
+	explain, _ = client.ExplainPermission(permUpdate, objs[2].UID, author, admin)
+	last := explain.Steps[len(explain.Steps)-1]
+	if !explain.Allowed || last.Permission != permSet || last.Group != "staff" || !last.Result {
+		t.Errorf("unexpected steps %+v", explain.Steps)
+	}
+
+	// set of an existing object is explained as the update Set checks
+	explain, err := client.ExplainPermission(permSet, objs[1].UID, editor, admin)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if explain.Permission != permUpdate {
+		t.Errorf("expected set of existing object to be explained as update, got %s", explain.Permission)
+	}
+	if err := client.Set(&types.Object{UID: objs[1].UID, Author: objs[1].Author, Data: objs[1].Data}, editor); explain.Allowed != (err == nil) {
+		t.Error("explain of set of existing object differs from set")
+	}
+}
@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// defaultSortField orders paginated queries that don't specify a sort.
+const defaultSortField = "_created"
+
+// QueryResult is a page of query results.
+type QueryResult struct {
+	Objects   []types.IndexObject
+	Full      []types.Object     // stored objects, only set when requested in query options
+	Fields    []string           // fields to limit API objects to
+	Scores    map[string]float64 // search relevance scores by uid
+	Distances map[string]float64 // distances in kilometers from the center of a radius query by uid
+	Cursor    string             // cursor of the next page, empty when there are no more results
+	Total     int                // total number of matches, only set when requested in query options
+	Explain   *QueryExplain      // how the query was evaluated, only set when requested in query options
+}
+
+// API converts query results to API objects.
+func (r *QueryResult) API() []types.APIObject {
+	out := make([]types.APIObject, 0)
+	if r.Full != nil {
+		for _, o := range r.Full {
+			out = append(out, r.scoreAPI(projectFields(o.API(), r.Fields)))
+		}
+		return out
+	}
+	for _, o := range r.Objects {
+		out = append(out, r.scoreAPI(projectFields(o.API(), r.Fields)))
+	}
+	return out
+}
+
+// scoreAPI adds the search relevance score and distance to API object.
+func (r *QueryResult) scoreAPI(o types.APIObject) types.APIObject {
+	if r.Scores != nil {
+		o[searchScoreField] = r.Scores[o.UID()]
+	}
+	if d, exists := r.Distances[o.UID()]; exists {
+		o[geoDistanceField] = d
+	}
+	return o
+}
+
+// projectFields returns API object with only the given fields, the uid is always kept.
+func projectFields(o types.APIObject, fields []string) types.APIObject {
+	if len(fields) == 0 {
+		return o
+	}
+	out := types.APIObject{"_uid": o["_uid"]}
+	for _, field := range fields {
+		if v, exists := o[field]; exists {
+			out[field] = v
+		}
+	}
+	return out
+}
+
+// querySort is a single field to order query results by.
+type querySort struct {
+	Field string
+	Desc  bool
+}
+
+// queryCursor is the position of the last object of a page of query results.
+type queryCursor struct {
+	Sort   []string      `json:"s"`
+	Values []interface{} `json:"v"`
+	UID    string        `json:"u"`
+}
+
+func parseQuerySort(fields []string) []querySort {
+	out := make([]querySort, 0)
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		s := querySort{Field: field}
+		switch field[0] {
+		case '-':
+			{
+				s.Field = field[1:]
+				s.Desc = true
+				break
+			}
+		case '+':
+			{
+				s.Field = field[1:]
+				break
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// sortValueRank orders values of different types, missing values are ordered last.
+func sortValueRank(v interface{}) int {
+	switch v.(type) {
+	case bool:
+		{
+			return 0
+		}
+	case int, int64, float64:
+		{
+			return 1
+		}
+	case string:
+		{
+			return 2
+		}
+	}
+	return 3
+}
+
+func sortValueFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int:
+		{
+			return float64(v)
+		}
+	case int64:
+		{
+			return float64(v)
+		}
+	case float64:
+		{
+			return v
+		}
+	}
+	return 0
+}
+
+// compareSortValues returns -1, 0 or 1 if a is less than, equal to or greater than b.
+func compareSortValues(a interface{}, b interface{}) int {
+	ra, rb := sortValueRank(a), sortValueRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case bool:
+		{
+			if a == b.(bool) {
+				return 0
+			} else if !a {
+				return -1
+			}
+			return 1
+		}
+	case string:
+		{
+			return strings.Compare(a, b.(string))
+		}
+	}
+	fa, fb := sortValueFloat(a), sortValueFloat(b)
+	if fa < fb {
+		return -1
+	} else if fa > fb {
+		return 1
+	}
+	return 0
+}
+
+// compareSortKeys compares two objects sort values, falling back to their uids.
+func compareSortKeys(sorts []querySort, a []interface{}, aUID string, b []interface{}, bUID string) int {
+	for i, s := range sorts {
+		cmp := compareSortValues(a[i], b[i])
+		// keep missing values last regardless of direction
+		if s.Desc && a[i] != nil && b[i] != nil {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return strings.Compare(aUID, bUID)
+}
+
+func sortValues(sorts []querySort, o *types.IndexObject, computed map[string]map[string]float64) []interface{} {
+	queryMap := o.QueryMap()
+	out := make([]interface{}, 0, len(sorts))
+	for _, s := range sorts {
+		if values, exists := computed[s.Field]; exists {
+			if v, exists := values[o.UID]; exists {
+				out = append(out, v)
+			} else {
+				out = append(out, nil)
+			}
+			continue
+		}
+		out = append(out, queryMap[s.Field])
+	}
+	return out
+}
+
+func encodeQueryCursor(cursor queryCursor) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeQueryCursor(value string, sortFields []string) (*queryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.WithStack(ErrInvalidCursor)
+	}
+	cursor := &queryCursor{}
+	if err := json.Unmarshal(raw, cursor); err != nil {
+		return nil, errors.WithStack(ErrInvalidCursor)
+	}
+	// cursor is only valid for the ordering it was created with
+	if strings.Join(cursor.Sort, ",") != strings.Join(sortFields, ",") || len(cursor.Values) != len(sortFields) {
+		return nil, errors.WithStack(ErrInvalidCursor)
+	}
+	return cursor, nil
+}
+
+// match returns the index objects that match query and that user is allowed to list.
+// Evaluation stops when ctx is done.
+func (c *Client) match(ctx context.Context, q string, u *types.User) ([]*types.IndexObject, error) {
+	expr, err := parseQuery(q)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	limits := c.getQueryLimits(u)
+	if err := limits.checkComplexity(expr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ctx, cancel := limits.context(ctx)
+	defer cancel()
+	matches, err := c.matchExpr(ctx, expr, u, nil)
+	return matches, errors.WithStack(err)
+}
+
+// matchExpr returns the index objects that match expression and that user is allowed to list.
+// When explain is given it's updated with the number of objects evaluated. Evaluation stops
+// when ctx is done.
+func (c *Client) matchExpr(ctx context.Context, expr queryExpr, u *types.User, explain *QueryExplain) ([]*types.IndexObject, error) {
+	c.indexSync.Lock()
+	var index []*types.IndexObject
+	indexName := explainIndexScan
+	// geo conditions narrow down the objects to evaluate using the spatial index
+	if g := requiredGeo(expr); g != nil {
+		index = c.geoCandidates(g)
+		indexName = explainIndexGeo + g.field
+	} else {
+		index = make([]*types.IndexObject, len(c.index))
+		copy(index, c.index)
+	}
+	c.indexSync.Unlock()
+	matches := make([]*types.IndexObject, 0)
+	denied := 0
+	rules := c.getFieldRules(u)
+	acl := c.getACLReader(u)
+	variables := c.queryVariables(u)
+	for i, obj := range index {
+		if i%queryCheckEvery == 0 && ctx.Err() != nil {
+			return nil, queryContextError(ctx.Err())
+		}
+		// hidden fields can't be queried
+		visible := rules.stripIndex(obj)
+		if expr.match(queryData(visible, variables)) {
+			if err := c.checkPermission(permList, u, obj); err != nil {
+				if errors.Is(err, ErrPermission) {
+					denied++
+					continue
+				}
+				return nil, errors.WithStack(err)
+			}
+			matches = append(matches, acl.stripIndex(visible))
+		}
+	}
+	if explain != nil {
+		explain.Index = indexName
+		explain.Scanned += len(index)
+		explain.Matched += len(matches) + denied
+		explain.Denied += denied
+	}
+	return matches, nil
+}
+
+// Query returns indexed objects based on provided query match.
+func (c *Client) Query(q string, u *types.User) ([]types.IndexObject, error) {
+	res, err := c.QueryWithOptions(q, types.QueryOptions{}, u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Objects, nil
+}
+
+// QueryWithOptions returns a page of indexed objects based on provided query match, ordered by the sort options.
+func (c *Client) QueryWithOptions(q string, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	res, err := c.QueryContext(context.Background(), q, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// QueryContext is QueryWithOptions that stops evaluating the query when ctx is done.
+func (c *Client) QueryContext(ctx context.Context, q string, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	start := time.Now()
+	if opts.Limit < 0 {
+		return nil, errors.WithStack(ErrInvalidArg)
+	}
+	if err := c.checkRawQuery(u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	expr, err := parseQuery(q)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := c.runQuery(ctx, expr, q, start, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// QueryFilter returns a page of indexed objects that match filter document, ordered by the sort options.
+func (c *Client) QueryFilter(filter types.Filter, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	res, err := c.QueryFilterContext(context.Background(), filter, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// QueryFilterContext is QueryFilter that stops evaluating the filter when ctx is done.
+func (c *Client) QueryFilterContext(ctx context.Context, filter types.Filter, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	start := time.Now()
+	if opts.Limit < 0 {
+		return nil, errors.WithStack(ErrInvalidArg)
+	}
+	if err := c.checkRawQuery(u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	expr, err := parseFilter(filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	rawFilter, err := json.Marshal(filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := c.runQuery(ctx, expr, string(rawFilter), start, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// runQuery returns the page of objects matching parsed query, q is the original query used
+// to explain and log it. The query limits of user are enforced.
+func (c *Client) runQuery(ctx context.Context, expr queryExpr, q string, start time.Time, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	limits := c.getQueryLimits(u)
+	if err := limits.checkComplexity(expr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ctx, cancel := limits.context(ctx)
+	defer cancel()
+	explain := &QueryExplain{Query: q}
+	matches, err := c.matchExpr(ctx, expr, u, explain)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	computed := make(map[string]map[string]float64)
+	if g := requiredGeo(expr); g != nil && g.center != nil {
+		computed[geoDistanceField] = geoDistances(g, matches)
+	}
+	res, err := c.queryPage(ctx, matches, opts, u, computed)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res.Distances = computed[geoDistanceField]
+	explain.Returned = len(res.Objects)
+	explain.Duration = time.Since(start)
+	c.logSlowQuery(explain, u)
+	if opts.Explain {
+		explain.Tree = expr.tree()
+		res.Explain = explain
+	}
+	return res, nil
+}
+
+// queryPage orders matches and returns the page of results requested in query options. Computed
+// holds values that aren't part of the index objects, i.e. search scores, by field and uid.
+// Objects are ordered and paged on the index, only the objects of the page are loaded when
+// full objects are requested. The total counts every match in the index.
+func (c *Client) queryPage(ctx context.Context, matches []*types.IndexObject, opts types.QueryOptions, u *types.User, computed map[string]map[string]float64) (*QueryResult, error) {
+	if err := c.getQueryLimits(u).checkResults(len(matches), opts); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var err error
+	res := &QueryResult{
+		Objects: make([]types.IndexObject, 0),
+		Fields:  opts.Fields,
+	}
+	if opts.Total {
+		res.Total = len(matches)
+	}
+	// without sorting or pagination results are in index order
+	if len(opts.Sort) == 0 && opts.Limit == 0 && opts.Cursor == "" {
+		_, err := c.pageObjects(ctx, res, matches, 0, opts, u)
+		return res, errors.WithStack(err)
+	}
+	sortFields := opts.Sort
+	if len(sortFields) == 0 {
+		sortFields = []string{defaultSortField}
+	}
+	sorts := parseQuerySort(sortFields)
+	values := make(map[string][]interface{}, len(matches))
+	for _, obj := range matches {
+		values[obj.UID] = sortValues(sorts, obj, computed)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return compareSortKeys(sorts, values[matches[i].UID], matches[i].UID, values[matches[j].UID], matches[j].UID) < 0
+	})
+	// skip to the object after the cursor
+	start := 0
+	if opts.Cursor != "" {
+		cursor, err := decodeQueryCursor(opts.Cursor, sortFields)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		start = sort.Search(len(matches), func(i int) bool {
+			return compareSortKeys(sorts, values[matches[i].UID], matches[i].UID, cursor.Values, cursor.UID) > 0
+		})
+	}
+	next, err := c.pageObjects(ctx, res, matches, start, opts, u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if opts.Limit > 0 && len(res.Objects) == opts.Limit && next < len(matches) {
+		last := res.Objects[len(res.Objects)-1]
+		res.Cursor, err = encodeQueryCursor(queryCursor{
+			Sort:   sortFields,
+			Values: values[last.UID],
+			UID:    last.UID,
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return res, nil
+}
+
+// pageObjects adds matches from start to the page of results, up to the limit in query options,
+// and returns the position after the last match used. When full objects are requested they're
+// loaded, matches deleted or denied since they were indexed are replaced by the next ones.
+// Loading stops when ctx is done.
+func (c *Client) pageObjects(ctx context.Context, res *QueryResult, matches []*types.IndexObject, start int, opts types.QueryOptions, u *types.User) (int, error) {
+	if opts.Full {
+		res.Full = make([]types.Object, 0)
+	}
+	i := start
+	for ; i < len(matches) && (opts.Limit == 0 || len(res.Objects) < opts.Limit); i++ {
+		if !opts.Full {
+			res.Objects = append(res.Objects, *matches[i])
+			continue
+		}
+		if ctx.Err() != nil {
+			return i, queryContextError(ctx.Err())
+		}
+		o, err := c.Get(matches[i].UID, u)
+		if err != nil {
+			// object may have been deleted or changed since it was indexed
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPermission) {
+				continue
+			}
+			return i, errors.WithStack(err)
+		}
+		res.Objects = append(res.Objects, *matches[i])
+		res.Full = append(res.Full, *o)
+	}
+	return i, nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// explainIndexScan is the index used when every object in the index is evaluated.
+const explainIndexScan = "index_scan"
+
+// QueryExplain describes how a query was evaluated.
+type QueryExplain struct {
+	Query    string                 // query string or filter document
+	Tree     map[string]interface{} // parse tree of query
+	Index    string                 // index the objects to evaluate were taken from
+	Scanned  int                    // number of objects query was evaluated against
+	Matched  int                    // number of objects that matched query
+	Denied   int                    // number of matches dropped because user isn't allowed to list them
+	Returned int                    // number of objects in the returned page
+	Duration time.Duration
+}
+
+// API converts query explain to API object.
+func (e *QueryExplain) API() types.APIObject {
+	return types.APIObject{
+		"query":       e.Query,
+		"tree":        e.Tree,
+		"index":       e.Index,
+		"scanned":     e.Scanned,
+		"matched":     e.Matched,
+		"denied":      e.Denied,
+		"returned":    e.Returned,
+		"duration_ms": float64(e.Duration.Microseconds()) / 1000,
+	}
+}
+
+// logSlowQuery logs query when it took longer than the configured slow query threshold.
+func (c *Client) logSlowQuery(e *QueryExplain, u *types.User) {
+	if c.slowQuery <= 0 || e.Duration < c.slowQuery {
+		return
+	}
+	user := "-"
+	if u != nil {
+		user = u.UID
+		if u.Username != "" {
+			user = u.Username
+		}
+	}
+	logWarn(fmt.Sprintf(
+		"slow query by %s took %s, scanned %d, matched %d, denied %d: %s",
+		user, e.Duration, e.Scanned, e.Matched, e.Denied, e.Query,
+	))
+}
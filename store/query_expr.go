@@ -0,0 +1,1031 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// Query language, compatible with the yql syntax previously used for queries and user group rules.
+//
+//   expr       := term ('or' term)*
+//   term       := factor ('and' factor)*
+//   factor     := 'not' factor | '(' expr ')' | geo | comparison
+//   geo        := 'near' '(' field ',' lat ',' lng ',' km ')' | 'inside' '(' field ',' lat ',' lng ',' lat ',' lng ')'
+//   comparison := field op value | field setOp '(' value (',' value)* ')' | field 'contains' value
+//   field      := (name | variable) ('.' name)* ('.' helper '()')*
+//   value      := string | number | bool | 'now()' (('+' | '-') duration)? | '$' param | variable
+//   variable   := '$user.' name
+//
+// Fields are dot paths in to the query map, i.e. 'address.city'. Comparisons against a
+// field that doesn't exist never match. Date strings and 'now()' expressions are compared
+// as times against fields holding dates or unix timestamps, i.e. 'publish_at < now() - 7d'.
+// Variables are bound to the current user when matching, i.e. 'team in $user.teams'.
+// Geo functions match fields holding {"lat", "lng"} points within km of a point or inside
+// the bounding box of a min and max point.
+
+const (
+	opEqual        = "="
+	opNotEqual     = "!="
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opIn           = "in"
+	opNotIn        = "!in"
+	opInter        = "∩"
+	opNotInter     = "!∩"
+	opContains     = "contains"
+
+	queryFloatEpsilon = 1e-10
+)
+
+// queryDurationUnits are the units of durations in 'now()' expressions.
+var queryDurationUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// queryHelpers are functions that can be applied to a field value, i.e. 'tags.count()'.
+var queryHelpers = map[string]func(v interface{}) interface{}{
+	"count": queryHelperCount,
+	"sum":   queryHelperSum,
+	"avg":   queryHelperAvg,
+	"max":   queryHelperMax,
+	"min":   queryHelperMin,
+}
+
+// queryExpr is a parsed query that can be matched against a query map.
+type queryExpr interface {
+	match(data map[string]interface{}) bool
+	tree() map[string]interface{} // parse tree used to explain query
+}
+
+type queryAnd struct {
+	left  queryExpr
+	right queryExpr
+}
+
+func (e *queryAnd) match(data map[string]interface{}) bool {
+	return e.left.match(data) && e.right.match(data)
+}
+
+func (e *queryAnd) tree() map[string]interface{} {
+	return map[string]interface{}{"and": []interface{}{e.left.tree(), e.right.tree()}}
+}
+
+type queryOr struct {
+	left  queryExpr
+	right queryExpr
+}
+
+func (e *queryOr) match(data map[string]interface{}) bool {
+	return e.left.match(data) || e.right.match(data)
+}
+
+func (e *queryOr) tree() map[string]interface{} {
+	return map[string]interface{}{"or": []interface{}{e.left.tree(), e.right.tree()}}
+}
+
+type queryNot struct {
+	expr queryExpr
+}
+
+func (e *queryNot) match(data map[string]interface{}) bool {
+	return !e.expr.match(data)
+}
+
+func (e *queryNot) tree() map[string]interface{} {
+	return map[string]interface{}{"not": e.expr.tree()}
+}
+
+// queryLiteral is a value in a query, its type is resolved against the value it's compared with.
+type queryLiteral struct {
+	raw      string
+	date     *time.Time // set when the literal is a date string
+	now      bool       // literal is the current time plus offset
+	offset   time.Duration
+	variable string // key of the query map value the literal is bound to when matching, i.e. '$user.uid'
+}
+
+// time returns the literal as a time if it's a date or 'now()' expression. A 'now()'
+// expression is relative to the time it was bound to, the current time when unbound.
+func (l queryLiteral) time() (time.Time, bool) {
+	if l.date != nil {
+		return *l.date, true
+	}
+	if l.now {
+		return time.Now().Add(l.offset), true
+	}
+	return time.Time{}, false
+}
+
+// String returns the literal as written in a query.
+func (l queryLiteral) String() string {
+	if l.now && l.offset < 0 {
+		return fmt.Sprintf("now() - %s", -l.offset)
+	} else if l.now && l.offset > 0 {
+		return fmt.Sprintf("now() + %s", l.offset)
+	}
+	return l.raw
+}
+
+// queryTime returns value as a time if it's a date string or unix timestamp.
+func queryTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		return types.ParseDate(s)
+	}
+	if f, ok := queryFloat(v); ok {
+		return time.Unix(int64(f), 0), true
+	}
+	return time.Time{}, false
+}
+
+type queryCompare struct {
+	field   string
+	helpers []string
+	op      string
+	values  []queryLiteral
+	any     bool // compare each element of array values, matching if any element does
+}
+
+func (e *queryCompare) match(data map[string]interface{}) bool {
+	if values, bound := e.bind(data); !bound {
+		return false
+	} else if values != nil {
+		boundExpr := *e
+		boundExpr.values = values
+		e = &boundExpr
+	}
+	actual, exists := data[e.field]
+	if !exists || actual == nil {
+		return false
+	}
+	for _, helper := range e.helpers {
+		actual = queryHelpers[helper](actual)
+		if actual == nil {
+			return false
+		}
+	}
+	if values, ok := actual.([]interface{}); ok {
+		if e.any {
+			for _, v := range values {
+				if e.matchValue(v) {
+					return true
+				}
+			}
+			return false
+		}
+		return compareQuerySet(values, e.values, e.op)
+	}
+	return e.matchValue(actual)
+}
+
+// bind returns the values of comparison with variables replaced by their value in data, nil
+// if it has no variables. Variables that aren't set never match. 'now()' expressions are
+// bound to the current time in data when it's set.
+func (e *queryCompare) bind(data map[string]interface{}) ([]queryLiteral, bool) {
+	now, hasNow := data[queryVariablePrefix+queryNowVariable].(time.Time)
+	hasVariables := false
+	for _, l := range e.values {
+		hasVariables = hasVariables || l.variable != "" || (l.now && hasNow)
+	}
+	if !hasVariables {
+		return nil, true
+	}
+	out := make([]queryLiteral, 0, len(e.values))
+	for _, l := range e.values {
+		if l.now && hasNow {
+			date := now.Add(l.offset)
+			l.date = &date
+		}
+		if l.variable == "" {
+			out = append(out, l)
+			continue
+		}
+		v, exists := data[l.variable]
+		if !exists || v == nil {
+			return nil, false
+		}
+		// list variables expand to their values, i.e. 'team in $user.teams'
+		list, isList := v.([]interface{})
+		if !isList {
+			list = []interface{}{v}
+		}
+		for _, item := range list {
+			bound, err := filterLiteral(item)
+			if err != nil || bound.variable != "" {
+				return nil, false
+			}
+			out = append(out, bound)
+		}
+	}
+	switch e.op {
+	case opIn, opNotIn, opInter, opNotInter:
+		{
+			return out, len(out) > 0
+		}
+	}
+	return out, len(out) == 1
+}
+
+func (e *queryCompare) tree() map[string]interface{} {
+	values := make([]interface{}, 0, len(e.values))
+	for _, v := range e.values {
+		values = append(values, v.String())
+	}
+	out := map[string]interface{}{
+		"field":  e.field,
+		"op":     e.op,
+		"values": values,
+	}
+	if len(e.helpers) > 0 {
+		out["helpers"] = e.helpers
+	}
+	if e.any {
+		out["any"] = true
+	}
+	return out
+}
+
+// matchValue compares a single non array value.
+func (e *queryCompare) matchValue(actual interface{}) bool {
+	switch e.op {
+	case opIn, opNotIn, opInter, opNotInter:
+		{
+			return compareQuerySet([]interface{}{actual}, e.values, e.op)
+		}
+	case opContains:
+		{
+			s, ok := actual.(string)
+			return ok && strings.Contains(s, e.values[0].raw)
+		}
+	}
+	return compareQueryValue(actual, e.values[0], e.op)
+}
+
+// compareQueryValue compares a single value with a literal converted to the value's type.
+func compareQueryValue(actual interface{}, expect queryLiteral, op string) bool {
+	if expectTime, ok := expect.time(); ok {
+		if actualTime, ok := queryTime(actual); ok {
+			switch {
+			case actualTime.Equal(expectTime):
+				{
+					return compareQueryOrder(0, op)
+				}
+			case actualTime.Before(expectTime):
+				{
+					return compareQueryOrder(-1, op)
+				}
+			}
+			return compareQueryOrder(1, op)
+		}
+		if expect.now {
+			return false
+		}
+	}
+	switch actual := actual.(type) {
+	case string:
+		{
+			return compareQueryOrder(strings.Compare(actual, expect.raw), op)
+		}
+	case bool:
+		{
+			b, err := strconv.ParseBool(expect.raw)
+			if err != nil {
+				return false
+			}
+			switch op {
+			case opEqual:
+				{
+					return actual == b
+				}
+			case opNotEqual:
+				{
+					return actual != b
+				}
+			}
+			return false
+		}
+	}
+	f, ok := queryFloat(actual)
+	if !ok {
+		return false
+	}
+	e, err := strconv.ParseFloat(expect.raw, 64)
+	if err != nil {
+		return false
+	}
+	switch {
+	case math.Abs(f-e) < queryFloatEpsilon:
+		{
+			return compareQueryOrder(0, op)
+		}
+	case f < e:
+		{
+			return compareQueryOrder(-1, op)
+		}
+	}
+	return compareQueryOrder(1, op)
+}
+
+// compareQueryOrder applies op to the result of a three way comparison.
+func compareQueryOrder(cmp int, op string) bool {
+	switch op {
+	case opEqual, opIn, opContains:
+		{
+			return cmp == 0
+		}
+	case opNotEqual, opNotIn:
+		{
+			return cmp != 0
+		}
+	case opGreater:
+		{
+			return cmp > 0
+		}
+	case opGreaterEqual:
+		{
+			return cmp >= 0
+		}
+	case opLess:
+		{
+			return cmp < 0
+		}
+	case opLessEqual:
+		{
+			return cmp <= 0
+		}
+	}
+	return false
+}
+
+func queryValueIn(actual interface{}, expect []queryLiteral) bool {
+	for _, e := range expect {
+		if compareQueryValue(actual, e, opEqual) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareQuerySet compares an array value with a set of literals.
+func compareQuerySet(actual []interface{}, expect []queryLiteral, op string) bool {
+	switch op {
+	case opContains:
+		{
+			return queryArrayContains(actual, expect[0])
+		}
+	case opEqual, opIn:
+		{
+			// every value belongs to the set
+			if len(actual) == 0 {
+				return false
+			}
+			for _, v := range actual {
+				if !queryValueIn(v, expect) {
+					return false
+				}
+			}
+			return true
+		}
+	case opNotEqual, opNotIn:
+		{
+			return !compareQuerySet(actual, expect, opIn)
+		}
+	case opInter:
+		{
+			for _, v := range actual {
+				if queryValueIn(v, expect) {
+					return true
+				}
+			}
+			return false
+		}
+	case opNotInter:
+		{
+			return !compareQuerySet(actual, expect, opInter)
+		}
+	}
+	return false
+}
+
+func queryArrayContains(actual []interface{}, expect queryLiteral) bool {
+	for _, v := range actual {
+		if compareQueryValue(v, expect, opEqual) {
+			return true
+		}
+	}
+	return false
+}
+
+func queryFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		{
+			return float64(v), true
+		}
+	case int64:
+		{
+			return float64(v), true
+		}
+	case float32:
+		{
+			return float64(v), true
+		}
+	case float64:
+		{
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func queryHelperCount(v interface{}) interface{} {
+	if values, ok := v.([]interface{}); ok {
+		return float64(len(values))
+	}
+	return float64(1)
+}
+
+func queryHelperNumbers(v interface{}) []float64 {
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	out := make([]float64, 0, len(values))
+	for _, value := range values {
+		if f, ok := queryFloat(value); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func queryHelperSum(v interface{}) interface{} {
+	sum := float64(0)
+	for _, f := range queryHelperNumbers(v) {
+		sum += f
+	}
+	return sum
+}
+
+func queryHelperAvg(v interface{}) interface{} {
+	numbers := queryHelperNumbers(v)
+	if len(numbers) == 0 {
+		return nil
+	}
+	return queryHelperSum(v).(float64) / float64(len(numbers))
+}
+
+func queryHelperMax(v interface{}) interface{} {
+	numbers := queryHelperNumbers(v)
+	if len(numbers) == 0 {
+		return nil
+	}
+	out := numbers[0]
+	for _, f := range numbers[1:] {
+		out = math.Max(out, f)
+	}
+	return out
+}
+
+func queryHelperMin(v interface{}) interface{} {
+	numbers := queryHelperNumbers(v)
+	if len(numbers) == 0 {
+		return nil
+	}
+	out := numbers[0]
+	for _, f := range numbers[1:] {
+		out = math.Min(out, f)
+	}
+	return out
+}
+
+const (
+	queryTokenEOF = iota
+	queryTokenName
+	queryTokenString
+	queryTokenNumber
+	queryTokenOp
+	queryTokenPunct
+	queryTokenDuration
+	queryTokenParam
+)
+
+type queryToken struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// lexQuery splits query in to tokens.
+func lexQuery(q string) ([]queryToken, error) {
+	out := make([]queryToken, 0)
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			{
+				i++
+			}
+		case r == '(' || r == ')' || r == ',' || r == '.' ||
+			((r == '+' || r == '-') && (i+1 >= len(runes) || !unicode.IsDigit(runes[i+1]))):
+			{
+				out = append(out, queryToken{kind: queryTokenPunct, value: string(r), pos: i})
+				i++
+			}
+		case r == '\'' || r == '"':
+			{
+				start := i
+				value := strings.Builder{}
+				i++
+				for ; i < len(runes) && runes[i] != r; i++ {
+					if runes[i] == '\\' && i+1 < len(runes) {
+						i++
+					}
+					value.WriteRune(runes[i])
+				}
+				if i >= len(runes) {
+					return nil, queryError(start, "unterminated string")
+				}
+				i++
+				out = append(out, queryToken{kind: queryTokenString, value: value.String(), pos: start})
+			}
+		case unicode.IsDigit(r) || ((r == '-' || r == '+') && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			{
+				start := i
+				i++
+				for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+					((runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+					i++
+				}
+				value := string(runes[start:i])
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return nil, queryError(start, "invalid number "+value)
+				}
+				// number followed by a unit is a duration, i.e. '7d'
+				if i < len(runes) && unicode.IsLetter(runes[i]) {
+					unitStart := i
+					for i < len(runes) && unicode.IsLetter(runes[i]) {
+						i++
+					}
+					unit := string(runes[unitStart:i])
+					if _, exists := queryDurationUnits[unit]; !exists {
+						return nil, queryError(unitStart, "unknown duration unit "+unit)
+					}
+					out = append(out, queryToken{kind: queryTokenDuration, value: value + unit, pos: start})
+					continue
+				}
+				out = append(out, queryToken{kind: queryTokenNumber, value: value, pos: start})
+			}
+		case unicode.IsLetter(r) || r == '_':
+			{
+				start := i
+				for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+					i++
+				}
+				out = append(out, queryToken{kind: queryTokenName, value: string(runes[start:i]), pos: start})
+			}
+		case r == '$':
+			{
+				start := i
+				i++
+				for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+					i++
+				}
+				if i == start+1 {
+					return nil, queryError(start, "expected parameter name")
+				}
+				out = append(out, queryToken{kind: queryTokenParam, value: string(runes[start+1 : i]), pos: start})
+			}
+		case r == '∩':
+			{
+				out = append(out, queryToken{kind: queryTokenOp, value: opInter, pos: i})
+				i++
+			}
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '∩':
+			{
+				out = append(out, queryToken{kind: queryTokenOp, value: opNotInter, pos: i})
+				i += 2
+			}
+		case r == '!' && i+2 < len(runes) && strings.ToLower(string(runes[i+1:i+3])) == "in":
+			{
+				out = append(out, queryToken{kind: queryTokenOp, value: opNotIn, pos: i})
+				i += 3
+			}
+		case r == '&' || r == '|':
+			{
+				if i+1 >= len(runes) || runes[i+1] != r {
+					return nil, queryError(i, "unexpected "+string(r))
+				}
+				value := "and"
+				if r == '|' {
+					value = "or"
+				}
+				out = append(out, queryToken{kind: queryTokenName, value: value, pos: i})
+				i += 2
+			}
+		case strings.ContainsRune("=!<>", r):
+			{
+				start := i
+				i++
+				if i < len(runes) && runes[i] == '=' {
+					i++
+				}
+				value := string(runes[start:i])
+				if value == "!" {
+					return nil, queryError(start, "unexpected !")
+				}
+				if value == "==" {
+					value = opEqual
+				}
+				out = append(out, queryToken{kind: queryTokenOp, value: value, pos: start})
+			}
+		default:
+			{
+				return nil, queryError(i, "unexpected "+string(r))
+			}
+		}
+	}
+	out = append(out, queryToken{kind: queryTokenEOF, pos: len(runes)})
+	return out, nil
+}
+
+func queryError(pos int, msg string) error {
+	return errors.Wrap(ErrInvalidQuery, fmt.Sprintf("%s at position %d", msg, pos))
+}
+
+// queryParser is a recursive descent parser of the query language.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	params map[string]queryLiteral
+}
+
+// parseQuery parses query in to an expression that can be matched against query maps.
+func parseQuery(q string) (queryExpr, error) {
+	return parseQueryParams(q, nil)
+}
+
+// parseQueryParams parses query binding the values of its '$name' parameters.
+func parseQueryParams(q string, params map[string]queryLiteral) (queryExpr, error) {
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, params: params}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != queryTokenEOF {
+		return nil, queryError(t.pos, "unexpected "+t.value)
+	}
+	return expr, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != queryTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword returns true if the next token is the given keyword.
+func (p *queryParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == queryTokenName && strings.EqualFold(t.value, keyword)
+}
+
+func (p *queryParser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == queryTokenPunct && t.value == punct
+}
+
+func (p *queryParser) expectPunct(punct string) error {
+	if !p.isPunct(punct) {
+		t := p.peek()
+		return queryError(t.pos, "expected "+punct)
+	}
+	p.next()
+	return nil
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseFactor() (queryExpr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		expr, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{expr: expr}, nil
+	}
+	if p.isPunct("(") {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	if t := p.peek(); t.kind == queryTokenName && (t.value == geoNear || t.value == geoInside) &&
+		p.tokens[p.pos+1].kind == queryTokenPunct && p.tokens[p.pos+1].value == "(" {
+		return p.parseGeo()
+	}
+	return p.parseComparison()
+}
+
+// parseGeo parses 'near(field, lat, lng, km)' and 'inside(field, min lat, min lng, max lat, max lng)'.
+func (p *queryParser) parseGeo() (queryExpr, error) {
+	fn := p.next()
+	p.next()
+	field, helpers, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if len(helpers) > 0 {
+		return nil, queryError(fn.pos, "expected field name")
+	}
+	args := make([]float64, 0, 4)
+	for p.isPunct(",") {
+		p.next()
+		t := p.peek()
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(v.raw, 64)
+		if err != nil {
+			return nil, queryError(t.pos, "expected number")
+		}
+		args = append(args, f)
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	var expr *queryGeo
+	switch {
+	case fn.value == geoNear && len(args) == 3:
+		{
+			expr, err = newQueryGeoRadius(field, types.GeoPoint{Lat: args[0], Lng: args[1]}, args[2])
+		}
+	case fn.value == geoInside && len(args) == 4:
+		{
+			expr, err = newQueryGeoBox(field, types.GeoPoint{Lat: args[0], Lng: args[1]}, types.GeoPoint{Lat: args[2], Lng: args[3]})
+		}
+	default:
+		{
+			return nil, queryError(fn.pos, "wrong number of arguments to "+fn.value)
+		}
+	}
+	if err != nil {
+		return nil, queryError(fn.pos, err.Error())
+	}
+	return expr, nil
+}
+
+func (p *queryParser) parseField() (string, []string, error) {
+	t := p.next()
+	if t.kind == queryTokenParam {
+		// user variables can be compared like fields, i.e. '$user.groups contains 'editor''
+		variable, err := p.parseVariable(t)
+		if err != nil {
+			return "", nil, err
+		}
+		t = queryToken{kind: queryTokenName, value: variable, pos: t.pos}
+	}
+	if t.kind != queryTokenName {
+		return "", nil, queryError(t.pos, "expected field name")
+	}
+	path := []string{t.value}
+	helpers := make([]string, 0)
+	for p.isPunct(".") {
+		p.next()
+		t := p.next()
+		if t.kind != queryTokenName {
+			return "", nil, queryError(t.pos, "expected field name")
+		}
+		if p.isPunct("(") {
+			if queryHelpers[t.value] == nil {
+				return "", nil, queryError(t.pos, "unknown function "+t.value)
+			}
+			p.next()
+			if err := p.expectPunct(")"); err != nil {
+				return "", nil, err
+			}
+			helpers = append(helpers, t.value)
+			continue
+		}
+		if len(helpers) > 0 {
+			return "", nil, queryError(t.pos, "expected function")
+		}
+		path = append(path, t.value)
+	}
+	return strings.Join(path, "."), helpers, nil
+}
+
+func (p *queryParser) parseValue() (queryLiteral, error) {
+	t := p.next()
+	switch t.kind {
+	case queryTokenString:
+		{
+			l := queryLiteral{raw: t.value}
+			if date, ok := types.ParseDate(t.value); ok {
+				l.date = &date
+			}
+			return l, nil
+		}
+	case queryTokenNumber:
+		{
+			return queryLiteral{raw: t.value}, nil
+		}
+	case queryTokenName:
+		{
+			value := strings.ToLower(t.value)
+			if value == "true" || value == "false" {
+				return queryLiteral{raw: value}, nil
+			}
+			if value == "now" && p.isPunct("(") {
+				return p.parseNow()
+			}
+		}
+	case queryTokenParam:
+		{
+			if l, exists := p.params[t.value]; exists {
+				return l, nil
+			}
+			variable, err := p.parseVariable(t)
+			if err != nil {
+				return queryLiteral{}, err
+			}
+			return queryLiteral{raw: variable, variable: variable}, nil
+		}
+	}
+	return queryLiteral{}, queryError(t.pos, "expected value")
+}
+
+// parseVariable parses the rest of a '$user.<name>' variable and returns its query map key.
+func (p *queryParser) parseVariable(t queryToken) (string, error) {
+	if t.value != queryUserVariable || !p.isPunct(".") {
+		return "", queryError(t.pos, "unknown parameter "+t.value)
+	}
+	p.next()
+	name := p.next()
+	if name.kind != queryTokenName {
+		return "", queryError(name.pos, "expected user attribute")
+	}
+	return queryVariablePrefix + queryUserVariable + "." + name.value, nil
+}
+
+// parseNow parses the rest of a 'now()' expression with an optional duration offset.
+func (p *queryParser) parseNow() (queryLiteral, error) {
+	p.next()
+	if err := p.expectPunct(")"); err != nil {
+		return queryLiteral{}, err
+	}
+	l := queryLiteral{raw: "now()", now: true}
+	sign := ""
+	if p.isPunct("+") || p.isPunct("-") {
+		sign = p.next().value
+		if t := p.peek(); t.kind != queryTokenDuration || strings.ContainsAny(t.value[:1], "+-") {
+			return queryLiteral{}, queryError(t.pos, "expected duration")
+		}
+	} else if t := p.peek(); t.kind != queryTokenDuration || !strings.ContainsAny(t.value[:1], "+-") {
+		// duration directly after 'now()' must be signed, i.e. 'now()-7d'
+		return l, nil
+	}
+	t := p.next()
+	offset, err := parseQueryDuration(sign + t.value)
+	if err != nil {
+		return queryLiteral{}, queryError(t.pos, "invalid duration "+t.value)
+	}
+	l.offset = offset
+	return l, nil
+}
+
+// parseQueryDuration parses a signed duration with a single unit, i.e. '-7d'.
+func parseQueryDuration(value string) (time.Duration, error) {
+	unit := strings.TrimLeft(value, "+-.0123456789")
+	if _, exists := queryDurationUnits[unit]; !exists {
+		return 0, errors.WithStack(ErrInvalidQuery)
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSuffix(value, unit), 64)
+	if err != nil {
+		return 0, errors.WithStack(ErrInvalidQuery)
+	}
+	return time.Duration(amount * float64(queryDurationUnits[unit])), nil
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	field, helpers, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	e := &queryCompare{field: field, helpers: helpers}
+	t := p.next()
+	switch {
+	case t.kind == queryTokenOp:
+		{
+			e.op = t.value
+		}
+	case t.kind == queryTokenName && (strings.EqualFold(t.value, opIn) || strings.EqualFold(t.value, opContains)):
+		{
+			e.op = strings.ToLower(t.value)
+		}
+	default:
+		{
+			return nil, queryError(t.pos, "expected operator")
+		}
+	}
+	switch e.op {
+	case opIn, opNotIn, opInter, opNotInter:
+		{
+			if t := p.peek(); t.kind == queryTokenParam {
+				// list parameter or variable, i.e. 'team in $user.teams'
+				v, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				e.values = []queryLiteral{v}
+				break
+			}
+			if err := p.expectPunct("("); err != nil {
+				return nil, err
+			}
+			for {
+				v, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				e.values = append(e.values, v)
+				if !p.isPunct(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		{
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			e.values = []queryLiteral{v}
+		}
+	}
+	return e, nil
+}
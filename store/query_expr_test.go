@@ -0,0 +1,194 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestQueryExpr(t *testing.T) {
+	data := map[string]interface{}{
+		"type":         "page",
+		"views":        float64(12),
+		"published":    true,
+		"title":        "It's a test",
+		"tags":         []interface{}{"news", "sport"},
+		"scores":       []interface{}{float64(1), float64(2), float64(3)},
+		"address.city": "Lyon",
+	}
+	tests := map[string]bool{
+		"type = 'page'":                             true,
+		"type != 'page'":                            false,
+		"views > 10 and views <= 12":                true,
+		"views < 10 or type = 'page'":               true,
+		"not (views < 10 or type = 'post')":         true,
+		"published = true":                          true,
+		"type in ('page', 'post')":                  true,
+		"type !in ('page', 'post')":                 false,
+		"title = 'It\\'s a test'":                   true,
+		"title contains 'test'":                     true,
+		"tags contains 'news'":                      true,
+		"tags contains 'music'":                     false,
+		"tags ∩ ('music', 'sport')":                 true,
+		"tags !∩ ('music', 'sport')":                false,
+		"tags in ('news', 'sport', 'music')":        true,
+		"tags.count() = 2":                          true,
+		"scores.sum() = 6 and scores.max() = 3":     true,
+		"address.city = 'Lyon'":                     true,
+		"address.country = 'France'":                false,
+		"address.country != 'France'":               false,
+		"missing = 1 or views = 12":                 true,
+		"type = 'page' and views = 1 or views = 12": true,
+	}
+	for q, expected := range tests {
+		expr, err := parseQuery(q)
+		if err != nil {
+			t.Errorf("%s: %s", q, err)
+			continue
+		}
+		if expr.match(data) != expected {
+			t.Errorf("%s: expected %v", q, expected)
+		}
+	}
+	for _, q := range []string{"", "type =", "type = 'page", "(type = 'page'", "tags.length() = 1", "type = 'a' and"} {
+		if _, err := parseQuery(q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected invalid query error", q)
+		}
+	}
+}
+
+func TestIndexNested(t *testing.T) {
+	o := &types.Object{
+		Data: map[string]interface{}{
+			"type": "place",
+			"name": "Office",
+			"address": map[string]interface{}{
+				"city": "Lyon",
+				"geo":  map[string]interface{}{"lat": 45.76},
+			},
+			"tags":  []interface{}{"work", "city"},
+			"items": []interface{}{map[string]interface{}{"sku": "a1"}, map[string]interface{}{"sku": "b2"}},
+		},
+	}
+	index := o.Index()
+	if index.Data["address.city"] != "Lyon" || index.Data["address.geo.lat"] != 45.76 {
+		t.Error("expected nested maps to be flattened")
+	}
+	if skus, _ := index.Data["items.sku"].([]interface{}); len(skus) != 2 {
+		t.Error("expected array of maps values to be indexed")
+	}
+
+	// per type config limits the indexed paths and value length
+	client := NewClient(&Config{
+		Index: map[string]types.IndexConfig{
+			"place": {Paths: []string{"name", "address.*"}, MaxLength: 3},
+		},
+	})
+	if err := client.Set(o, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	res, err := client.Query("address.city = 'Lyo' and tags contains 'work'", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 0 {
+		t.Error("expected tags not to be indexed")
+	}
+	res, err = client.Query("address.city = 'Lyo' and address.geo.lat > 45 and name = 'Off'", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 {
+		t.Error("expected one result")
+	}
+
+	// nested paths can be used in user group rules
+	client = NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"lyon": {Get: "address.city = 'Lyon' and tags contains 'work'"},
+		},
+	})
+	if err := client.Set(o, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	u := &types.User{UID: "reader", Groups: []string{"lyon"}}
+	if _, err := client.Get(o.UID, u); err != nil {
+		t.Error(err)
+	}
+	other := &types.Object{Data: map[string]interface{}{"type": "place"}}
+	client.Set(other, nil)
+	if _, err := client.Get(other.UID, u); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+}
+
+func TestQueryDates(t *testing.T) {
+	now := time.Now()
+	data := map[string]interface{}{
+		"_created":   now.Add(-48 * time.Hour).Unix(),
+		"publish_at": now.Add(-time.Hour).UTC().Format(time.RFC3339),
+		"expire_at":  "2030-01-01T02:00:00+02:00",
+		"views":      float64(-3),
+	}
+	tests := map[string]bool{
+		"publish_at <= now()":                     true,
+		"publish_at > now() - 2h":                 true,
+		"publish_at > now()-30m":                  false,
+		"_created < now() - 1d":                   true,
+		"_created > '2020-01-01'":                 true,
+		"expire_at = '2030-01-01T00:00:00Z'":      true,
+		"expire_at > '2029-12-31T23:00:00-02:00'": false,
+		"views > -5 and views < -1":               true,
+		"views < now()":                           true,
+	}
+	for q, expected := range tests {
+		expr, err := parseQuery(q)
+		if err != nil {
+			t.Errorf("%s: %s", q, err)
+			continue
+		}
+		if expr.match(data) != expected {
+			t.Errorf("%s: expected %v", q, expected)
+		}
+	}
+	for _, q := range []string{"publish_at < now() - 7", "publish_at < now() - 7y", "publish_at < now() +"} {
+		if _, err := parseQuery(q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected invalid query error", q)
+		}
+	}
+
+	// declared date paths are normalized and usable in group rules
+	client := NewClient(&Config{
+		Index: map[string]types.IndexConfig{
+			"event": {Dates: []string{"publish_at"}},
+		},
+		UserGroups: map[string]UserGroup{
+			"anonymous": {Get: "type = 'event' and publish_at <= now()"},
+		},
+	})
+	past := &types.Object{Data: map[string]interface{}{"type": "event", "publish_at": now.Add(-time.Hour).Unix()}}
+	future := &types.Object{Data: map[string]interface{}{"type": "event", "publish_at": now.Add(time.Hour).Format(time.RFC3339)}}
+	client.Set(past, nil)
+	client.Set(future, nil)
+	index, _ := client.Index()
+	for _, o := range index {
+		if _, ok := o.Data["publish_at"].(string); !ok {
+			t.Error("expected declared date to be indexed as string")
+		}
+	}
+	u := &types.User{UID: "visitor", Groups: []string{"anonymous"}}
+	res, err := client.Query("type = 'event'", u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0].UID != past.UID {
+		t.Error("expected only the published event")
+	}
+}
@@ -0,0 +1,417 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// Filter documents compile to the same expressions as query strings. Field keys map to a
+// value to match or to an operator document, i.e. {"views": {"$gt": 10}}. Unlike query
+// strings, a value matches array fields that contain it and '$ne' / '$nin' also match
+// objects without the field.
+
+const (
+	filterAnd      = "$and"
+	filterOr       = "$or"
+	filterNor      = "$nor"
+	filterNot      = "$not"
+	filterEq       = "$eq"
+	filterNe       = "$ne"
+	filterGt       = "$gt"
+	filterGte      = "$gte"
+	filterLt       = "$lt"
+	filterLte      = "$lte"
+	filterIn       = "$in"
+	filterNin      = "$nin"
+	filterAll      = "$all"
+	filterContains = "$contains"
+	filterExists   = "$exists"
+	filterNow      = "$now"
+	filterNear     = "$near"
+	filterBox      = "$box"
+	filterUser     = "$user"
+)
+
+// filterOps maps filter comparison operators to query operators.
+var filterOps = map[string]string{
+	filterEq:  opEqual,
+	filterGt:  opGreater,
+	filterGte: opGreaterEqual,
+	filterLt:  opLess,
+	filterLte: opLessEqual,
+}
+
+// queryExists matches objects that have a value for field.
+type queryExists struct {
+	field string
+}
+
+func (e *queryExists) match(data map[string]interface{}) bool {
+	v, exists := data[e.field]
+	return exists && v != nil
+}
+
+func (e *queryExists) tree() map[string]interface{} {
+	return map[string]interface{}{"exists": e.field}
+}
+
+// queryAll matches when every expression matches, it matches when there are none.
+type queryAll struct {
+	exprs []queryExpr
+}
+
+func (e *queryAll) match(data map[string]interface{}) bool {
+	for _, expr := range e.exprs {
+		if !expr.match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *queryAll) tree() map[string]interface{} {
+	return map[string]interface{}{"and": exprTrees(e.exprs)}
+}
+
+// queryAny matches when any expression matches.
+type queryAny struct {
+	exprs []queryExpr
+}
+
+func (e *queryAny) match(data map[string]interface{}) bool {
+	for _, expr := range e.exprs {
+		if expr.match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *queryAny) tree() map[string]interface{} {
+	return map[string]interface{}{"or": exprTrees(e.exprs)}
+}
+
+func exprTrees(exprs []queryExpr) []interface{} {
+	out := make([]interface{}, 0, len(exprs))
+	for _, expr := range exprs {
+		out = append(out, expr.tree())
+	}
+	return out
+}
+
+func filterError(msg string) error {
+	return errors.Wrap(ErrInvalidQuery, msg)
+}
+
+// parseFilter compiles filter document in to an expression that can be matched against query maps.
+func parseFilter(filter map[string]interface{}) (queryExpr, error) {
+	if filter == nil {
+		return nil, filterError("empty filter")
+	}
+	// sort keys so the expression is evaluated in a stable order
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := &queryAll{exprs: make([]queryExpr, 0, len(keys))}
+	for _, k := range keys {
+		var expr queryExpr
+		var err error
+		switch k {
+		case filterAnd, filterOr, filterNor:
+			{
+				expr, err = parseFilterList(k, filter[k])
+				break
+			}
+		default:
+			{
+				if strings.HasPrefix(k, "$") {
+					return nil, filterError("unknown operator " + k)
+				}
+				expr, err = parseFilterField(k, filter[k])
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.exprs = append(out.exprs, expr)
+	}
+	return out, nil
+}
+
+func parseFilterList(op string, v interface{}) (queryExpr, error) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, filterError(op + " expects a list of filters")
+	}
+	exprs := make([]queryExpr, 0, len(list))
+	for _, item := range list {
+		filter, ok := filterMap(item)
+		if !ok {
+			return nil, filterError(op + " expects a list of filters")
+		}
+		expr, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	switch op {
+	case filterOr:
+		{
+			return &queryAny{exprs: exprs}, nil
+		}
+	case filterNor:
+		{
+			return &queryNot{expr: &queryAny{exprs: exprs}}, nil
+		}
+	}
+	return &queryAll{exprs: exprs}, nil
+}
+
+// filterMap returns v as a filter document.
+func filterMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		{
+			return v, true
+		}
+	case types.Filter:
+		{
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseFilterField compiles the conditions of a single field.
+func parseFilterField(field string, v interface{}) (queryExpr, error) {
+	ops, ok := filterMap(v)
+	if ok && !isFilterOperators(ops) {
+		_, isNow := ops[filterNow]
+		_, isUser := ops[filterUser]
+		if !isNow && !isUser {
+			// nested document matches the dot paths below field
+			nested := make(map[string]interface{}, len(ops))
+			for k, v := range ops {
+				if strings.HasPrefix(k, "$") {
+					return nil, filterError("operator " + k + " can't be mixed with fields")
+				}
+				nested[field+"."+k] = v
+			}
+			return parseFilter(nested)
+		}
+	}
+	if !ok || !isFilterOperators(ops) {
+		// plain value is an equality match
+		if v == nil {
+			return &queryNot{expr: &queryExists{field: field}}, nil
+		}
+		return parseFilterOperator(field, filterEq, v)
+	}
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := &queryAll{exprs: make([]queryExpr, 0, len(keys))}
+	for _, k := range keys {
+		expr, err := parseFilterOperator(field, k, ops[k])
+		if err != nil {
+			return nil, err
+		}
+		out.exprs = append(out.exprs, expr)
+	}
+	return out, nil
+}
+
+// isFilterOperators returns true if every key of document is an operator.
+func isFilterOperators(doc map[string]interface{}) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for k := range doc {
+		if !strings.HasPrefix(k, "$") || k == filterNow || k == filterUser {
+			return false
+		}
+	}
+	return true
+}
+
+func parseFilterOperator(field string, op string, v interface{}) (queryExpr, error) {
+	switch op {
+	case filterEq, filterGt, filterGte, filterLt, filterLte, filterContains:
+		{
+			l, err := filterLiteral(v)
+			if err != nil {
+				return nil, err
+			}
+			if op == filterContains {
+				return &queryCompare{field: field, op: opContains, values: []queryLiteral{l}}, nil
+			}
+			return &queryCompare{field: field, op: filterOps[op], values: []queryLiteral{l}, any: true}, nil
+		}
+	case filterNe:
+		{
+			expr, err := parseFilterOperator(field, filterEq, v)
+			if err != nil {
+				return nil, err
+			}
+			return &queryNot{expr: expr}, nil
+		}
+	case filterIn, filterNin, filterAll:
+		{
+			list, ok := v.([]interface{})
+			if l, err := filterLiteral(v); !ok && err == nil && l.variable != "" {
+				// list user variable, i.e. {"$in": {"$user": "teams"}}
+				list, ok = []interface{}{v}, true
+			}
+			if !ok || len(list) == 0 {
+				return nil, filterError(op + " expects a list of values")
+			}
+			values := make([]queryLiteral, 0, len(list))
+			for _, item := range list {
+				l, err := filterLiteral(item)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, l)
+			}
+			switch op {
+			case filterNin:
+				{
+					return &queryNot{expr: &queryCompare{field: field, op: opIn, values: values, any: true}}, nil
+				}
+			case filterAll:
+				{
+					exprs := make([]queryExpr, 0, len(values))
+					for _, l := range values {
+						exprs = append(exprs, &queryCompare{field: field, op: opEqual, values: []queryLiteral{l}, any: true})
+					}
+					return &queryAll{exprs: exprs}, nil
+				}
+			}
+			return &queryCompare{field: field, op: opIn, values: values, any: true}, nil
+		}
+	case filterExists:
+		{
+			exists, ok := v.(bool)
+			if !ok {
+				return nil, filterError(op + " expects a boolean")
+			}
+			if !exists {
+				return &queryNot{expr: &queryExists{field: field}}, nil
+			}
+			return &queryExists{field: field}, nil
+		}
+	case filterNear:
+		{
+			doc, _ := filterMap(v)
+			center, ok := types.ParseGeoPoint(doc)
+			km, isNumber := queryFloat(doc["km"])
+			if !ok || !isNumber {
+				return nil, filterError(op + " expects a document with lat, lng and km")
+			}
+			expr, err := newQueryGeoRadius(field, center, km)
+			if err != nil {
+				return nil, filterError(err.Error())
+			}
+			return expr, nil
+		}
+	case filterBox:
+		{
+			doc, _ := filterMap(v)
+			min, isMin := types.ParseGeoPoint(doc["min"])
+			max, isMax := types.ParseGeoPoint(doc["max"])
+			if !isMin || !isMax {
+				return nil, filterError(op + " expects a document with min and max points")
+			}
+			expr, err := newQueryGeoBox(field, min, max)
+			if err != nil {
+				return nil, filterError(err.Error())
+			}
+			return expr, nil
+		}
+	case filterNot:
+		{
+			ops, ok := filterMap(v)
+			if !ok || !isFilterOperators(ops) {
+				return nil, filterError(op + " expects an operator document")
+			}
+			expr, err := parseFilterField(field, ops)
+			if err != nil {
+				return nil, err
+			}
+			return &queryNot{expr: expr}, nil
+		}
+	}
+	return nil, filterError("unknown operator " + op)
+}
+
+// filterLiteral converts a filter document value to a query literal.
+func filterLiteral(v interface{}) (queryLiteral, error) {
+	switch v := v.(type) {
+	case string:
+		{
+			l := queryLiteral{raw: v}
+			if date, ok := types.ParseDate(v); ok {
+				l.date = &date
+			}
+			return l, nil
+		}
+	case bool:
+		{
+			return queryLiteral{raw: strconv.FormatBool(v)}, nil
+		}
+	case int:
+		{
+			return queryLiteral{raw: strconv.Itoa(v)}, nil
+		}
+	case int64:
+		{
+			return queryLiteral{raw: strconv.FormatInt(v, 10)}, nil
+		}
+	case float64:
+		{
+			return queryLiteral{raw: strconv.FormatFloat(v, 'f', -1, 64)}, nil
+		}
+	case time.Time:
+		{
+			return queryLiteral{raw: v.Format(time.RFC3339Nano), date: &v}, nil
+		}
+	}
+	// {"$user": "uid"} is bound to the user variable when matching
+	if doc, ok := filterMap(v); ok && len(doc) == 1 {
+		if name, exists := doc[filterUser]; exists {
+			s, _ := name.(string)
+			if s == "" {
+				return queryLiteral{}, filterError(filterUser + " expects a user attribute name")
+			}
+			variable := queryVariablePrefix + queryUserVariable + "." + s
+			return queryLiteral{raw: variable, variable: variable}, nil
+		}
+	}
+	// {"$now": "-7d"} is the current time plus an optional offset
+	if doc, ok := filterMap(v); ok && len(doc) == 1 {
+		if offset, exists := doc[filterNow]; exists {
+			l := queryLiteral{raw: "now()", now: true}
+			if s, _ := offset.(string); s != "" {
+				d, err := parseQueryDuration(s)
+				if err != nil {
+					return queryLiteral{}, filterError("invalid duration " + s)
+				}
+				l.offset = d
+			}
+			return l, nil
+		}
+	}
+	return queryLiteral{}, filterError(fmt.Sprintf("unsupported value %v", v))
+}
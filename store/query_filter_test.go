@@ -0,0 +1,84 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestQueryFilter(t *testing.T) {
+	data := map[string]interface{}{
+		"type":         "page",
+		"views":        float64(12),
+		"title":        "It's a test",
+		"tags":         []interface{}{"news", "sport"},
+		"address.city": "Lyon",
+		"publish_at":   time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+	}
+	tests := map[string]bool{
+		`{"type": "page"}`: true,
+		`{"type": "page", "views": {"$gt": 10, "$lte": 12}}`:          true,
+		`{"type": "page", "views": {"$gt": 12}}`:                      false,
+		`{"title": "It's a test"}`:                                    true,
+		`{"tags": "news"}`:                                            true,
+		`{"tags": {"$all": ["news", "sport"]}}`:                       true,
+		`{"tags": {"$nin": ["music"]}}`:                               true,
+		`{"tags": {"$ne": "news"}}`:                                   false,
+		`{"missing": {"$ne": 1}}`:                                     true,
+		`{"missing": {"$exists": false}, "views": {"$exists": true}}`: true,
+		`{"missing": null}`:                                           true,
+		`{"address": {"city": "Lyon"}}`:                               true,
+		`{"$or": [{"type": "post"}, {"views": {"$in": [1, 12]}}]}`:    true,
+		`{"$nor": [{"type": "post"}, {"views": 12}]}`:                 false,
+		`{"views": {"$not": {"$lt": 5}}}`:                             true,
+		`{"title": {"$contains": "test"}}`:                            true,
+		`{"publish_at": {"$lte": {"$now": ""}}}`:                      true,
+		`{"publish_at": {"$lte": {"$now": "-2h"}}}`:                   false,
+	}
+	for raw, expected := range tests {
+		filter := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+			t.Error(err)
+			return
+		}
+		expr, err := parseFilter(filter)
+		if err != nil {
+			t.Errorf("%s: %s", raw, err)
+			continue
+		}
+		if expr.match(data) != expected {
+			t.Errorf("%s: expected %v", raw, expected)
+		}
+	}
+	for _, raw := range []string{`{"$where": "x"}`, `{"views": {"$gt": [1]}}`, `{"$or": {}}`, `{"views": {"$in": 1}}`} {
+		filter := map[string]interface{}{}
+		json.Unmarshal([]byte(raw), &filter)
+		if _, err := parseFilter(filter); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected invalid query error", raw)
+		}
+	}
+}
+
+func TestQueryFilterUserGroup(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"reader": {Get: map[string]interface{}{"type": "page", "tags": map[string]interface{}{"$in": []interface{}{"public"}}}},
+		},
+	})
+	public := &types.Object{Data: map[string]interface{}{"type": "page", "tags": []interface{}{"public", "news"}}}
+	private := &types.Object{Data: map[string]interface{}{"type": "page", "tags": []interface{}{"news"}}}
+	client.Set(public, nil)
+	client.Set(private, nil)
+	u := &types.User{UID: "reader", Groups: []string{"reader"}}
+	res, err := client.QueryFilter(types.Filter{"type": "page"}, types.QueryOptions{}, u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 1 || res.Objects[0].UID != public.UID {
+		t.Error("expected only the public page")
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// queryCheckEvery is the number of objects evaluated between checks for query cancellation.
+const queryCheckEvery = 256
+
+// queryLimits are the resource limits applied to the queries of a user, zero values are unlimited.
+type queryLimits struct {
+	maxResults    int
+	maxComplexity int
+	timeout       time.Duration
+}
+
+// getQueryLimits returns the query limits of user. As with permissions the most permissive
+// of the user's groups applies, so a group without a limit lifts it.
+func (c *Client) getQueryLimits(u *types.User) queryLimits {
+	userGroups := c.getUserGroups(u)
+	if len(userGroups) == 0 {
+		return queryLimits{}
+	}
+	out := queryLimits{
+		maxResults:    userGroups[0].MaxResults,
+		maxComplexity: userGroups[0].MaxComplexity,
+		timeout:       time.Duration(userGroups[0].Timeout) * time.Millisecond,
+	}
+	for _, userGroup := range userGroups[1:] {
+		out.maxResults = maxQueryLimit(out.maxResults, userGroup.MaxResults)
+		out.maxComplexity = maxQueryLimit(out.maxComplexity, userGroup.MaxComplexity)
+		out.timeout = time.Duration(maxQueryLimit(int(out.timeout/time.Millisecond), userGroup.Timeout)) * time.Millisecond
+	}
+	return out
+}
+
+func maxQueryLimit(a int, b int) int {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// context returns a context that's cancelled when the query timeout is reached.
+func (l queryLimits) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.timeout)
+}
+
+// checkComplexity returns an error if expression has more nodes than allowed.
+func (l queryLimits) checkComplexity(expr queryExpr) error {
+	if l.maxComplexity <= 0 {
+		return nil
+	}
+	if n := queryComplexity(expr.tree()); n > l.maxComplexity {
+		return errors.Wrapf(ErrQueryLimit, "query has %d conditions, the maximum is %d", n, l.maxComplexity)
+	}
+	return nil
+}
+
+// checkResults returns an error if a page of the given matches could return more objects than allowed.
+func (l queryLimits) checkResults(matches int, opts types.QueryOptions) error {
+	if l.maxResults <= 0 || (opts.Limit > 0 && opts.Limit <= l.maxResults) || matches <= l.maxResults {
+		return nil
+	}
+	return errors.Wrapf(ErrQueryLimit, "query matches %d objects, set a limit of at most %d", matches, l.maxResults)
+}
+
+// queryComplexity returns the number of nodes in a query parse tree.
+func queryComplexity(v interface{}) int {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		{
+			n := 1
+			for _, child := range v {
+				n += queryComplexity(child)
+			}
+			return n
+		}
+	case []interface{}:
+		{
+			n := 0
+			for _, child := range v {
+				n += queryComplexity(child)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// queryContextError converts the error of a done query context.
+func queryContextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.WithStack(ErrQueryTimeout)
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestQueryLimits(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"anonymous": {Get: true, MaxResults: 3, MaxComplexity: 4, Timeout: 1000},
+			"editor":    {Get: true, MaxResults: 5},
+			"admin":     {Get: true},
+		},
+	})
+	for i := 0; i < 5; i++ {
+		client.Set(&types.Object{Data: map[string]interface{}{"type": "limit", "n": i}}, nil)
+	}
+	anonymous := &types.User{UID: "anonymous", Groups: []string{"anonymous"}}
+
+	// results over the limit need an explicit page size
+	if _, err := client.Query("type = 'limit'", anonymous); !errors.Is(err, ErrQueryLimit) {
+		t.Error("expected query limit error")
+	}
+	if _, err := client.QueryWithOptions("type = 'limit'", types.QueryOptions{Limit: 4}, anonymous); !errors.Is(err, ErrQueryLimit) {
+		t.Error("expected query limit error")
+	}
+	res, err := client.QueryWithOptions("type = 'limit'", types.QueryOptions{Limit: 3}, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 3 || res.Cursor == "" {
+		t.Error("expected a page of three objects")
+	}
+	if res, err := client.Query("type = 'limit' and n < 2", anonymous); err != nil || len(res) != 2 {
+		t.Error("expected results under the limit")
+	}
+
+	// complexity counts the nodes of the parse tree
+	if _, err := client.Query("n = 1 or n = 2 or n = 3", anonymous); !errors.Is(err, ErrQueryLimit) {
+		t.Error("expected complexity limit error")
+	}
+	if _, err := client.QueryFilter(types.Filter{"n": map[string]interface{}{"$in": []interface{}{1, 2}}, "type": "limit"}, types.QueryOptions{}, anonymous); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Aggregate("n = 1 or n = 2 or n = 3", nil, nil, anonymous); !errors.Is(err, ErrQueryLimit) {
+		t.Error("expected complexity limit error on aggregate")
+	}
+
+	// the most permissive group applies
+	if _, err := client.Query("type = 'limit'", &types.User{UID: "editor", Groups: []string{"anonymous", "editor"}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Query("n = 1 or n = 2 or n = 3", &types.User{UID: "admin", Groups: []string{"anonymous", "admin"}}); err != nil {
+		t.Error(err)
+	}
+
+	// evaluation stops when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := client.QueryContext(ctx, "type = 'limit'", types.QueryOptions{}, nil); !errors.Is(err, ErrQueryTimeout) {
+		t.Error("expected query timeout error")
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.QueryContext(ctx, "type = 'limit'", types.QueryOptions{}, nil); !errors.Is(err, context.Canceled) {
+		t.Error("expected cancelled query")
+	}
+}
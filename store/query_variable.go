@@ -0,0 +1,69 @@
+package store
+
+import (
+	"strings"
+
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	// queryVariablePrefix prefixes the query map keys variables are bound to, object data
+	// keys with the prefix are removed so objects can't set variables.
+	queryVariablePrefix = "$"
+	// queryUserVariable is the variable holding the current user, i.e. '$user.uid'.
+	queryUserVariable = "user"
+	// queryNowVariable holds the current time of the client clock that 'now()' expressions are relative to.
+	queryNowVariable = "now"
+)
+
+// queryVariables returns the variables bound when matching queries and rules for user.
+func (c *Client) queryVariables(u *types.User) map[string]interface{} {
+	out := userVariables(u)
+	if out == nil {
+		out = make(map[string]interface{}, 1)
+	}
+	out[queryVariablePrefix+queryNowVariable] = c.clock.time()
+	return out
+}
+
+// userVariables returns the query map values of the '$user' variable, its built in
+// attributes are uid, username and groups, custom user attributes are added as is.
+func userVariables(u *types.User) map[string]interface{} {
+	if u == nil {
+		return nil
+	}
+	prefix := queryVariablePrefix + queryUserVariable + "."
+	out := make(map[string]interface{}, len(u.Attributes)+3)
+	for k, v := range u.Attributes {
+		if list, ok := v.([]string); ok {
+			values := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				values = append(values, item)
+			}
+			v = values
+		}
+		out[prefix+k] = v
+	}
+	groups := make([]interface{}, 0, len(u.Groups))
+	for _, group := range u.Groups {
+		groups = append(groups, group)
+	}
+	out[prefix+"uid"] = u.UID
+	out[prefix+"username"] = u.Username
+	out[prefix+"groups"] = groups
+	return out
+}
+
+// queryData returns the query map of index object with the given variables bound.
+func queryData(o *types.IndexObject, variables map[string]interface{}) map[string]interface{} {
+	data := o.QueryMap()
+	for k := range data {
+		if strings.HasPrefix(k, queryVariablePrefix) {
+			delete(data, k)
+		}
+	}
+	for k, v := range variables {
+		data[k] = v
+	}
+	return data
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestUserVariables(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"member": {
+				Get:    "team in $user.teams or $user.groups contains 'auditor'",
+				Update: "team in $user.teams and _author != $user.uid",
+				Delete: map[string]interface{}{"owner": map[string]interface{}{"$user": "username"}},
+			},
+			"auditor": {Get: false},
+		},
+	})
+	red := &types.Object{Data: map[string]interface{}{"type": "task", "team": "red", "owner": "alice"}}
+	blue := &types.Object{Data: map[string]interface{}{"type": "task", "team": "blue", "owner": "bob", "$user.teams": []interface{}{"blue"}}}
+	client.Set(red, nil)
+	client.Set(blue, nil)
+	alice := &types.User{UID: "alice_uid", Username: "alice", Groups: []string{"member"}, Attributes: map[string]interface{}{"teams": []string{"red", "green"}}}
+
+	// list attribute
+	if _, err := client.Get(red.UID, alice); err != nil {
+		t.Error(err)
+	}
+	// objects can't set variables
+	if _, err := client.Get(blue.UID, alice); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+	res, err := client.Query("type = 'task'", alice)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0].UID != red.UID {
+		t.Error("expected only the team's task")
+	}
+	// variables in queries
+	if res, _ := client.Query("owner = $user.username", alice); len(res) != 1 {
+		t.Error("expected variable to be bound in query")
+	}
+	if _, err := client.Query("owner = $user", alice); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("expected invalid query error")
+	}
+
+	// built in variables
+	red.Data["title"] = "Updated"
+	if err := client.Set(red, alice); err != nil {
+		t.Error(err)
+	}
+	if err := client.Delete(red, alice); err != nil {
+		t.Error(err)
+	}
+	if err := client.Delete(blue, alice); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+
+	// users without the attribute never match
+	bob := &types.User{UID: "bob_uid", Username: "bob", Groups: []string{"member", "auditor"}}
+	if _, err := client.Get(blue.UID, bob); err != nil {
+		t.Error(err)
+	}
+	if err := client.Set(blue, bob); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const usagePrefix = "usage_"
+
+// Usage is the number of objects and stored bytes of an author, with their quota.
+type Usage struct {
+	UID        string `json:"uid"`
+	Objects    int    `json:"objects"`
+	Bytes      int64  `json:"bytes"`
+	MaxObjects int    `json:"-"` // zero for no limit
+	MaxBytes   int64  `json:"-"` // zero for no limit
+}
+
+// API converts usage to API object.
+func (u *Usage) API() types.APIObject {
+	return types.APIObject{
+		"uid":         u.UID,
+		"objects":     u.Objects,
+		"bytes":       u.Bytes,
+		"max_objects": u.MaxObjects,
+		"max_bytes":   u.MaxBytes,
+	}
+}
+
+// quota is the storage quota of a user. The largest quota set by the user's groups applies,
+// groups that don't set one don't lift it, zero values are unlimited.
+type quota struct {
+	maxObjects int
+	maxBytes   int64
+}
+
+func (c *Client) getQuota(u *types.User) quota {
+	out := quota{}
+	for _, userGroup := range c.getUserGroups(u) {
+		if userGroup.MaxObjects > out.maxObjects {
+			out.maxObjects = userGroup.MaxObjects
+		}
+		if userGroup.MaxBytes > out.maxBytes {
+			out.maxBytes = userGroup.MaxBytes
+		}
+	}
+	return out
+}
+
+// check returns ErrQuota if usage changed by the given number of objects and bytes is over
+// quota. Changes that don't add objects or bytes are always allowed, so authors over quota
+// can still shrink and delete their objects.
+func (q quota) check(usage *Usage, objects int, bytes int64) error {
+	if objects > 0 && q.maxObjects > 0 && usage.Objects+objects > q.maxObjects {
+		return errors.Wrapf(ErrQuota, "%d of %d objects used", usage.Objects, q.maxObjects)
+	}
+	if bytes > 0 && q.maxBytes > 0 && usage.Bytes+bytes > q.maxBytes {
+		return errors.Wrapf(ErrQuota, "%d of %d bytes used", usage.Bytes, q.maxBytes)
+	}
+	return nil
+}
+
+// objectSize returns the number of bytes object takes in the store.
+func objectSize(o *types.Object) int64 {
+	if o == nil {
+		return 0
+	}
+	raw, _ := json.Marshal(o)
+	return int64(len(raw))
+}
+
+func (c *Client) getUsage(uid string) (*Usage, error) {
+	out := &Usage{UID: uid}
+	if err := c.getRaw(usagePrefix+uid, out); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// getAuthorQuota returns the quota of the author of uid, authors that aren't users have none.
+func (c *Client) getAuthorQuota(uid string, u *types.User) (quota, error) {
+	if u != nil && u.UID == uid {
+		return c.getQuota(u), nil
+	}
+	author, err := c.GetUser(uid)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return quota{}, nil
+		}
+		return quota{}, errors.WithStack(err)
+	}
+	return c.getQuota(author), nil
+}
+
+// updateUsage records the change in usage of writing object over existing object, either nil
+// for creates and deletes. Usage is updated atomically so writes from other clients aren't lost.
+// Unless user is trusted, a change that adds to the usage of an author is checked against the
+// quota of the author, whoever makes the write, and ErrQuota returned with no usage changed.
+// Writing existing over object with a nil user reverts the change.
+func (c *Client) updateUsage(u *types.User, o *types.Object, existing *types.Object) error {
+	changes := make(map[string]*Usage)
+	add := func(o *types.Object, sign int) {
+		if o == nil || o.Author == "" {
+			return
+		}
+		if changes[o.Author] == nil {
+			changes[o.Author] = &Usage{UID: o.Author}
+		}
+		changes[o.Author].Objects += sign
+		changes[o.Author].Bytes += int64(sign) * objectSize(o)
+	}
+	add(existing, -1)
+	add(o, 1)
+	uids := make([]string, 0, len(changes))
+	for uid, change := range changes {
+		if change.Objects != 0 || change.Bytes != 0 {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids)
+	for i, uid := range uids {
+		change := changes[uid]
+		q := quota{}
+		if u != nil && (change.Objects > 0 || change.Bytes > 0) {
+			var err error
+			if q, err = c.getAuthorQuota(uid, u); err != nil {
+				c.revertUsage(changes, uids[:i])
+				return errors.WithStack(err)
+			}
+		}
+		usage := &Usage{}
+		err := updateKey(c.store, usagePrefix+uid, usage, func(found bool) (updateAction, error) {
+			if err := q.check(usage, change.Objects, change.Bytes); err != nil {
+				return updateSkip, errors.WithStack(err)
+			}
+			usage.UID = uid
+			usage.Objects += change.Objects
+			usage.Bytes += change.Bytes
+			return updateSet, nil
+		})
+		if err != nil {
+			c.revertUsage(changes, uids[:i])
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// revertUsage undoes the usage changes already applied to the authors of uids.
+func (c *Client) revertUsage(changes map[string]*Usage, uids []string) {
+	for _, uid := range uids {
+		usage := &Usage{}
+		err := updateKey(c.store, usagePrefix+uid, usage, func(found bool) (updateAction, error) {
+			usage.UID = uid
+			usage.Objects -= changes[uid].Objects
+			usage.Bytes -= changes[uid].Bytes
+			return updateSet, nil
+		})
+		if err != nil {
+			logWarnErr(err, fmt.Sprintf("failed to revert usage of %s", uid))
+		}
+	}
+}
+
+// replaceUsage replaces the usage of every author, i.e. after recounting it from the stored objects.
+func (c *Client) replaceUsage(usage map[string]*Usage) error {
+	keys, err := listKeys(c.store, usagePrefix)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, key := range keys {
+		if usage[strings.TrimPrefix(key, usagePrefix)] == nil {
+			if err := c.store.Delete(key); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	for uid, authorUsage := range usage {
+		if err := c.store.Set(usagePrefix+uid, authorUsage); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Usage returns the storage usage and quota of the user of uid, users can see their own usage and admins any.
+func (c *Client) Usage(uid string, u *types.User) (*Usage, error) {
+	if u != nil && u.UID != uid && !c.IsAdmin(u) {
+		return nil, errors.WithStack(ErrPermission)
+	}
+	author, err := c.GetUser(uid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out, err := c.getUsage(uid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	q := c.getQuota(author)
+	out.MaxObjects = q.maxObjects
+	out.MaxBytes = q.maxBytes
+	return out, nil
+}
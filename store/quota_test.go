@@ -0,0 +1,119 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestQuota(t *testing.T) {
+	config := &Config{
+		UserGroups: map[string]UserGroup{
+			"member": {Get: true, Set: true, Update: true, Delete: true, MaxObjects: 2, MaxBytes: 1024},
+			"staff":  {Get: true, Update: true},
+			"bulk":   {Set: true, MaxObjects: 5},
+			"editor": {Set: true, MaxObjects: 1, Inherits: []string{"staff"}},
+		},
+	}
+	client := NewClient(config)
+	u := &types.User{Username: "quota", Groups: []string{"member"}}
+	if err := client.SetUser(u); err != nil {
+		t.Error(err)
+		return
+	}
+	objs := make([]*types.Object, 0)
+	for i := 0; i < 2; i++ {
+		o := &types.Object{Data: map[string]interface{}{"type": "note", "n": i}}
+		if err := client.Set(o, u); err != nil {
+			t.Error(err)
+			return
+		}
+		objs = append(objs, o)
+	}
+	if err := client.Set(&types.Object{Data: map[string]interface{}{"type": "note"}}, u); !errors.Is(err, ErrQuota) {
+		t.Error("expected object quota error")
+	}
+	usage, err := client.Usage(u.UID, u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if usage.Objects != 2 || usage.Bytes != objectSize(objs[0])+objectSize(objs[1]) || usage.MaxObjects != 2 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if _, err := client.Usage(u.UID, &types.User{UID: "other"}); !errors.Is(err, ErrPermission) {
+		t.Error("expected only user and admins to see usage")
+	}
+
+	// updates may not grow past the byte quota
+	objs[0].Data["body"] = string(make([]byte, 1024))
+	if err := client.Set(objs[0], u); !errors.Is(err, ErrQuota) {
+		t.Error("expected byte quota error")
+	}
+
+	// writes by other users count against the quota of the author
+	staff := &types.User{UID: "staff", Groups: []string{"staff"}}
+	if err := client.Set(objs[0], staff); !errors.Is(err, ErrQuota) {
+		t.Error("expected byte quota error on update by other user")
+	}
+	delete(objs[0].Data, "body")
+
+	// deletes free the quota
+	if err := client.Delete(objs[1], u); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := client.Set(&types.Object{Data: map[string]interface{}{"type": "note"}}, u); err != nil {
+		t.Error(err)
+	}
+
+	// usage is recounted when rebuilding the index
+	client.store.Set(usagePrefix+u.UID, &Usage{Objects: 100})
+	if _, err := client.RebuildIndex(); err != nil {
+		t.Error(err)
+		return
+	}
+	if usage, _ := client.Usage(u.UID, nil); usage.Objects != 2 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	// inherited groups without a quota don't lift the quota of the group
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	if err := client.Set(&types.Object{Data: map[string]interface{}{"type": "note"}}, editor); err != nil {
+		t.Error(err)
+	}
+	if err := client.Set(&types.Object{Data: map[string]interface{}{"type": "note"}}, editor); !errors.Is(err, ErrQuota) {
+		t.Error("expected object quota error with inherited group")
+	}
+
+	// concurrent writes from clients sharing the storage can't overrun the quota
+	client2 := NewClient(config)
+	client2.store = client.store
+	bulk := &types.User{Username: "bulk", Groups: []string{"bulk"}}
+	if err := client.SetUser(bulk); err != nil {
+		t.Error(err)
+		return
+	}
+	created := int32(0)
+	var wg sync.WaitGroup
+	for _, c := range []*Client{client, client2} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := c.Set(&types.Object{Data: map[string]interface{}{"type": "note"}}, bulk); err == nil {
+					atomic.AddInt32(&created, 1)
+				} else if !errors.Is(err, ErrQuota) {
+					t.Error(err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	if usage, _ := client.Usage(bulk.UID, nil); created != 5 || usage.Objects != 5 {
+		t.Errorf("expected quota to hold, created %d with usage %+v", created, usage)
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	ratePrefix        = "rate_"
+	defaultRateWindow = time.Hour
+	ratePruneEvery    = 1024 // number of checks between pruning full buckets from memory or the storage backend
+)
+
+// RateLimitConfig defines rate limiter configuration.
+type RateLimitConfig struct {
+	Shared bool `yaml:"shared"` // keep the buckets in the storage backend so instances sharing it share limits
+}
+
+// rateLimit is the number of requests allowed per window, the most permissive of the user's groups applies.
+type rateLimit struct {
+	limit  int
+	window time.Duration
+}
+
+// rateBucket is a token bucket holding up to limit tokens, refilled at limit tokens per window.
+type rateBucket struct {
+	Tokens  float64       `json:"tokens"`
+	Updated time.Time     `json:"updated"`
+	Window  time.Duration `json:"window"`
+}
+
+// full returns true if bucket has refilled by now, it's then the same as a new bucket.
+func (b *rateBucket) full(now time.Time) bool {
+	window := b.Window
+	if window <= 0 {
+		window = defaultRateWindow
+	}
+	return now.Sub(b.Updated) >= window
+}
+
+// rateLimiter tracks the token buckets of users and IP addresses.
+type rateLimiter struct {
+	lock    sync.Mutex
+	shared  bool
+	buckets map[string]*rateBucket
+	checks  int
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		shared:  config.Shared,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+func (c *Client) getRateLimit(u *types.User) rateLimit {
+	userGroups := c.getUserGroups(u)
+	out := rateLimit{}
+	for i, userGroup := range userGroups {
+		window := defaultRateWindow
+		if userGroup.RateWindow > 0 {
+			window = time.Duration(userGroup.RateWindow) * time.Millisecond
+		}
+		if userGroup.RateLimit <= 0 {
+			return rateLimit{}
+		}
+		// compare the rates so a larger limit over a longer window isn't mistaken as more permissive
+		if i == 0 || float64(userGroup.RateLimit)/float64(window) > float64(out.limit)/float64(out.window) {
+			out = rateLimit{limit: userGroup.RateLimit, window: window}
+		}
+	}
+	return out
+}
+
+// take removes a token from bucket, refilled up to now, and returns how long until one is
+// available when it's empty.
+func (l rateLimit) take(bucket *rateBucket, now time.Time) time.Duration {
+	rate := float64(l.limit) / float64(l.window)
+	if bucket.Updated.IsZero() {
+		bucket.Tokens = float64(l.limit)
+	} else if elapsed := now.Sub(bucket.Updated); elapsed > 0 {
+		bucket.Tokens = math.Min(float64(l.limit), bucket.Tokens+float64(elapsed)*rate)
+	}
+	bucket.Updated = now
+	bucket.Window = l.window
+	if bucket.Tokens < 1 {
+		return time.Duration(math.Ceil((1 - bucket.Tokens) / rate))
+	}
+	bucket.Tokens--
+	return 0
+}
+
+// CheckRateLimit takes a request token from the bucket of key, a user or IP address, limited by
+// the rate limit of user's groups. When the limit is exceeded it returns ErrRateLimit and how
+// long until the next request is allowed.
+func (c *Client) CheckRateLimit(key string, u *types.User) (time.Duration, error) {
+	limit := c.getRateLimit(u)
+	if limit.limit <= 0 {
+		return 0, nil
+	}
+	now := c.clock.time()
+	l := c.rateLimiter
+	var retryAfter time.Duration
+	if l.shared {
+		// take the token atomically so instances sharing the storage can't overspend the bucket
+		bucket := &rateBucket{}
+		err := updateKey(c.store, ratePrefix+key, bucket, func(found bool) (updateAction, error) {
+			retryAfter = limit.take(bucket, now)
+			return updateSet, nil
+		})
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		l.lock.Lock()
+		l.checks++
+		prune := l.checks%ratePruneEvery == 0
+		l.lock.Unlock()
+		if prune {
+			if err := c.pruneSharedRateBuckets(now); err != nil {
+				logWarnErr(err, "rate limit prune error")
+			}
+		}
+	} else {
+		l.lock.Lock()
+		bucket := l.buckets[key]
+		if bucket == nil {
+			bucket = &rateBucket{}
+			l.buckets[key] = bucket
+		}
+		retryAfter = limit.take(bucket, now)
+		if l.checks++; l.checks%ratePruneEvery == 0 {
+			l.prune(now)
+		}
+		l.lock.Unlock()
+	}
+	if retryAfter > 0 {
+		return retryAfter, errors.Wrapf(ErrRateLimit, "retry after %s", retryAfter.Round(time.Second))
+	}
+	return 0, nil
+}
+
+// prune removes the buckets that have refilled, they're the same as a new bucket.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// pruneSharedRateBuckets removes the buckets in the storage backend that have refilled.
+func (c *Client) pruneSharedRateBuckets(now time.Time) error {
+	keys, err := listKeys(c.store, ratePrefix)
+	if err != nil {
+		if errors.Is(err, ErrNotSupported) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	for _, key := range keys {
+		bucket := &rateBucket{}
+		err := updateKey(c.store, key, bucket, func(found bool) (updateAction, error) {
+			// checked again under the update, another instance may have just taken a token
+			if !found || !bucket.full(now) {
+				return updateSkip, nil
+			}
+			return updateDelete, nil
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
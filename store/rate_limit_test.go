@@ -0,0 +1,99 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestRateLimit(t *testing.T) {
+	config := &Config{
+		UserGroups: map[string]UserGroup{
+			"anonymous": {RateLimit: 2, RateWindow: 60000},
+			"member":    {RateLimit: 10, RateWindow: 60000},
+			"admin":     {},
+		},
+	}
+	client := NewClient(config)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.SetClock(func() time.Time { return now })
+	anonymous := &types.User{UID: "anonymous", Groups: []string{"anonymous"}}
+	for i := 0; i < 2; i++ {
+		if _, err := client.CheckRateLimit("ip:1", anonymous); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	retryAfter, err := client.CheckRateLimit("ip:1", anonymous)
+	if !errors.Is(err, ErrRateLimit) || retryAfter != 30*time.Second {
+		t.Errorf("expected rate limit error with retry after 30s, got %s", retryAfter)
+	}
+	if _, err := client.CheckRateLimit("ip:2", anonymous); err != nil {
+		t.Error("expected separate bucket per key")
+	}
+	// tokens refill over the window
+	now = now.Add(30 * time.Second)
+	if _, err := client.CheckRateLimit("ip:1", anonymous); err != nil {
+		t.Error(err)
+	}
+	// most permissive group applies, a group without a limit lifts it
+	member := &types.User{UID: "member", Groups: []string{"anonymous", "member"}}
+	if limit := client.getRateLimit(member); limit.limit != 10 {
+		t.Errorf("unexpected limit %+v", limit)
+	}
+	admin := &types.User{UID: "admin", Groups: []string{"anonymous", "admin"}}
+	for i := 0; i < 5; i++ {
+		if _, err := client.CheckRateLimit("user:admin", admin); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// shared buckets are kept in the storage backend
+	config.RateLimit.Shared = true
+	client = NewClient(config)
+	client2 := NewClient(config)
+	client2.store = client.store
+	client.SetClock(func() time.Time { return now })
+	client2.SetClock(func() time.Time { return now })
+	client.CheckRateLimit("ip:1", anonymous)
+	client2.CheckRateLimit("ip:1", anonymous)
+	if _, err := client.CheckRateLimit("ip:1", anonymous); !errors.Is(err, ErrRateLimit) {
+		t.Error("expected shared rate limit")
+	}
+
+	// concurrent checks on instances sharing a bucket never allow more than the limit
+	member = &types.User{UID: "member", Groups: []string{"member"}}
+	allowed := int32(0)
+	var wg sync.WaitGroup
+	for _, c := range []*Client{client, client2} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := c.CheckRateLimit("user:member", member); err == nil {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("expected 10 allowed requests, got %d", allowed)
+	}
+
+	// refilled buckets are removed from the storage backend
+	if keys, _ := listKeys(client.store, ratePrefix); len(keys) != 2 {
+		t.Errorf("unexpected rate buckets %v", keys)
+	}
+	if err := client.pruneSharedRateBuckets(now.Add(time.Minute)); err != nil {
+		t.Error(err)
+	}
+	if keys, _ := listKeys(client.store, ratePrefix); len(keys) != 0 {
+		t.Errorf("expected refilled rate buckets to be removed, got %v", keys)
+	}
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	paramString = "string"
+	paramNumber = "number"
+	paramBool   = "bool"
+	paramDate   = "date"
+)
+
+// SavedQuery is a named query with typed parameters. Parameters are referenced in the
+// query as '$name' and are bound as values, never interpolated in to the query string.
+type SavedQuery struct {
+	Query  string            `yaml:"query"`
+	Params map[string]string `yaml:"params"` // parameter name => type, one of string, number, bool or date
+	Groups []string          `yaml:"groups"` // user groups allowed to run the query, every user when empty
+}
+
+// bind converts the given parameter values to query literals of their declared types.
+func (q SavedQuery) bind(values map[string]interface{}) (map[string]queryLiteral, error) {
+	for name := range values {
+		if _, exists := q.Params[name]; !exists {
+			return nil, errors.Wrapf(ErrInvalidArg, "unknown parameter %s", name)
+		}
+	}
+	out := make(map[string]queryLiteral, len(q.Params))
+	for name, paramType := range q.Params {
+		v, exists := values[name]
+		if !exists || v == nil {
+			return nil, errors.Wrapf(ErrInvalidArg, "missing parameter %s", name)
+		}
+		l, err := bindParam(paramType, v)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidArg, "parameter %s must be a %s", name, paramType)
+		}
+		out[name] = l
+	}
+	return out, nil
+}
+
+// bindParam converts value to a query literal of the given type, strings are parsed so
+// parameters can be passed as url values.
+func bindParam(paramType string, v interface{}) (queryLiteral, error) {
+	s, isString := v.(string)
+	switch paramType {
+	case paramString:
+		{
+			if !isString {
+				return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+			}
+			return queryLiteral{raw: s}, nil
+		}
+	case paramNumber:
+		{
+			if isString {
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+				}
+				v = f
+			}
+			if _, ok := queryFloat(v); !ok {
+				return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+			}
+			return filterLiteral(v)
+		}
+	case paramBool:
+		{
+			if isString {
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+				}
+				v = b
+			}
+			if _, ok := v.(bool); !ok {
+				return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+			}
+			return filterLiteral(v)
+		}
+	case paramDate:
+		{
+			if t, ok := v.(time.Time); ok {
+				return filterLiteral(t)
+			}
+			t, ok := types.ParseDate(s)
+			if !isString || !ok {
+				return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+			}
+			return filterLiteral(t)
+		}
+	}
+	return queryLiteral{}, errors.WithStack(ErrInvalidArg)
+}
+
+// compile parses the query with the given parameter values.
+func (q SavedQuery) compile(values map[string]interface{}) (queryExpr, error) {
+	params, err := q.bind(values)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	expr, err := parseQueryParams(q.Query, params)
+	return expr, errors.WithStack(err)
+}
+
+// validate checks that the query parses with its declared parameters.
+func (q SavedQuery) validate() error {
+	values := make(map[string]interface{}, len(q.Params))
+	for name, paramType := range q.Params {
+		switch paramType {
+		case paramString:
+			{
+				values[name] = ""
+				break
+			}
+		case paramNumber:
+			{
+				values[name] = float64(0)
+				break
+			}
+		case paramBool:
+			{
+				values[name] = false
+				break
+			}
+		case paramDate:
+			{
+				values[name] = time.Time{}
+				break
+			}
+		default:
+			{
+				return errors.Wrapf(ErrInvalidQuery, "unknown type %s of parameter %s", paramType, name)
+			}
+		}
+	}
+	_, err := q.compile(values)
+	return errors.WithStack(err)
+}
+
+// savedQueryAllowed returns true if user belongs to, or inherits, a group that may run the query.
+func (c *Client) savedQueryAllowed(q SavedQuery, u *types.User) bool {
+	if u == nil || len(q.Groups) == 0 {
+		return true
+	}
+	for _, group := range q.Groups {
+		for _, name := range userGroupNames(c.getUserGroupMap(), u.Groups) {
+			if name == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkRawQuery returns a permission error if every group of user only allows saved queries.
+func (c *Client) checkRawQuery(u *types.User) error {
+	userGroups := c.getUserGroups(u)
+	if len(userGroups) == 0 {
+		return nil
+	}
+	for _, userGroup := range userGroups {
+		if !userGroup.SavedQueriesOnly {
+			return nil
+		}
+	}
+	return errors.WithStack(ErrPermission)
+}
+
+// SavedQuery returns a page of indexed objects that match the named saved query with the given parameters.
+func (c *Client) SavedQuery(name string, params map[string]interface{}, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	res, err := c.SavedQueryContext(context.Background(), name, params, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// SavedQueryContext is SavedQuery that stops evaluating the query when ctx is done.
+func (c *Client) SavedQueryContext(ctx context.Context, name string, params map[string]interface{}, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	start := time.Now()
+	if opts.Limit < 0 {
+		return nil, errors.WithStack(ErrInvalidArg)
+	}
+	q, exists := c.savedQueries[name]
+	if !exists {
+		return nil, errors.Wrapf(ErrNotFound, "saved query %s", name)
+	}
+	if !c.savedQueryAllowed(q, u) {
+		return nil, errors.WithStack(ErrPermission)
+	}
+	expr, err := q.compile(params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := c.runQuery(ctx, expr, savedQueryString(name, params), start, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// savedQueryString returns saved query call as a string, i.e. 'pages_by_author(author=bob)'.
+func savedQueryString(name string, params map[string]interface{}) string {
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	args := make([]string, 0, len(names))
+	for _, k := range names {
+		args = append(args, fmt.Sprintf("%s=%v", k, params[k]))
+	}
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
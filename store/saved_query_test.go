@@ -0,0 +1,104 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestSavedQuery(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"anonymous": {Get: true, SavedQueriesOnly: true},
+			"editor":    {Get: true},
+		},
+		Queries: map[string]SavedQuery{
+			"pages_by_author": {
+				Query:  "type = 'page' and author = $author and views >= $min_views",
+				Params: map[string]string{"author": paramString, "min_views": paramNumber},
+			},
+			"editor_pages": {
+				Query:  "type = 'page'",
+				Groups: []string{"editor"},
+			},
+		},
+	})
+	for _, author := range []string{"bob", "o'brien", "alice"} {
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"type":   "page",
+				"author": author,
+				"views":  10,
+			},
+		}, nil)
+	}
+	anonymous := &types.User{UID: "anonymous", Groups: []string{"anonymous"}}
+
+	res, err := client.SavedQuery("pages_by_author", map[string]interface{}{"author": "o'brien", "min_views": "5"}, types.QueryOptions{}, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 1 || res.Objects[0].Data["author"] != "o'brien" {
+		t.Error("expected page by o'brien")
+	}
+
+	// parameters are bound as values, not interpolated
+	res, err = client.SavedQuery("pages_by_author", map[string]interface{}{"author": "x' or type = 'page", "min_views": 0}, types.QueryOptions{}, anonymous)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 0 {
+		t.Error("expected no results")
+	}
+
+	// parameters are type checked
+	for _, params := range []map[string]interface{}{
+		{"author": "bob"},
+		{"author": "bob", "min_views": "many"},
+		{"author": 1, "min_views": 1},
+		{"author": "bob", "min_views": 1, "other": 1},
+	} {
+		if _, err := client.SavedQuery("pages_by_author", params, types.QueryOptions{}, anonymous); !errors.Is(err, ErrInvalidArg) {
+			t.Errorf("%v: expected invalid argument error", params)
+		}
+	}
+
+	if _, err := client.SavedQuery("missing", nil, types.QueryOptions{}, anonymous); !errors.Is(err, ErrNotFound) {
+		t.Error("expected not found error")
+	}
+	if _, err := client.SavedQuery("editor_pages", nil, types.QueryOptions{}, anonymous); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+
+	// raw queries are restricted for groups that only allow saved queries
+	if _, err := client.Query("type = 'page'", anonymous); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+	editor := &types.User{UID: "editor", Groups: []string{"anonymous", "editor"}}
+	if _, err := client.Query("type = 'page'", editor); err != nil {
+		t.Error(err)
+	}
+	res, err = client.SavedQuery("editor_pages", nil, types.QueryOptions{}, editor)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 3 {
+		t.Error("expected three pages")
+	}
+}
+
+func TestSavedQueryValidate(t *testing.T) {
+	if err := (SavedQuery{Query: "a = $b", Params: map[string]string{"b": paramDate}}).validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (SavedQuery{Query: "a = $c", Params: map[string]string{"b": paramString}}).validate(); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("expected invalid query error for unknown parameter")
+	}
+	if err := (SavedQuery{Query: "a = $b", Params: map[string]string{"b": "list"}}).validate(); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("expected invalid query error for unknown type")
+	}
+}
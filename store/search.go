@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+const (
+	searchScoreField = "_score"
+	// bm25 ranking parameters
+	searchK1 = 1.2
+	searchB  = 0.75
+)
+
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "no": true,
+	"not": true, "of": true, "on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true, "this": true, "to": true,
+	"was": true, "will": true, "with": true,
+}
+
+// SearchConfig defines the object fields included in the full-text index.
+type SearchConfig struct {
+	Fields []string `yaml:"fields"`
+	Types  []string `yaml:"types"` // only index objects of these types, all types when empty
+}
+
+// searchIndex is an in memory inverted index of object string fields. Frequencies and lengths
+// are kept per field so that fields hidden from a user can be left out of their search.
+type searchIndex struct {
+	config   SearchConfig
+	postings map[string]map[string]map[string]int // term => uid => field => term frequency
+	docTerms map[string][]string                  // uid => unique terms
+	docLen   map[string]map[string]int            // uid => field => number of terms
+	totalLen int
+	lock     sync.RWMutex
+}
+
+func newSearchIndex(config SearchConfig) *searchIndex {
+	return &searchIndex{
+		config:   config,
+		postings: make(map[string]map[string]map[string]int),
+		docTerms: make(map[string][]string),
+		docLen:   make(map[string]map[string]int),
+	}
+}
+
+// reset removes every object from the search index.
+func (s *searchIndex) reset() {
+	if !s.enabled() {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.postings = make(map[string]map[string]map[string]int)
+	s.docTerms = make(map[string][]string)
+	s.docLen = make(map[string]map[string]int)
+	s.totalLen = 0
+}
+
+// enabled returns true if any fields are configured to be searchable.
+func (s *searchIndex) enabled() bool {
+	return s != nil && len(s.config.Fields) > 0
+}
+
+// tokenizeSearchText splits text in to stemmed lower case terms with stop words removed.
+func tokenizeSearchText(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	out := make([]string, 0, len(words))
+	for _, word := range words {
+		if searchStopWords[word] {
+			continue
+		}
+		out = append(out, english.Stem(word, false))
+	}
+	return out
+}
+
+// documentFields returns the text of the searchable fields of object by field.
+func (s *searchIndex) documentFields(o *types.Object) map[string]string {
+	if len(s.config.Types) > 0 {
+		objType, _ := o.Data["type"].(string)
+		hasType := false
+		for _, t := range s.config.Types {
+			if t == objType {
+				hasType = true
+				break
+			}
+		}
+		if !hasType {
+			return nil
+		}
+	}
+	out := make(map[string]string, len(s.config.Fields))
+	for _, field := range s.config.Fields {
+		if v, ok := o.Data[field].(string); ok {
+			out[field] = v
+		}
+	}
+	return out
+}
+
+func (s *searchIndex) remove(uid string) {
+	for _, term := range s.docTerms[uid] {
+		delete(s.postings[term], uid)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+	for _, n := range s.docLen[uid] {
+		s.totalLen -= n
+	}
+	delete(s.docTerms, uid)
+	delete(s.docLen, uid)
+}
+
+// set adds object to the search index, replacing its previous entry.
+func (s *searchIndex) set(o *types.Object) {
+	if !s.enabled() {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(o.UID)
+	frequencies := make(map[string]map[string]int)
+	lengths := make(map[string]int)
+	for field, text := range s.documentFields(o) {
+		terms := tokenizeSearchText(text)
+		for _, term := range terms {
+			if frequencies[term] == nil {
+				frequencies[term] = make(map[string]int)
+			}
+			frequencies[term][field]++
+		}
+		if len(terms) > 0 {
+			lengths[field] = len(terms)
+			s.totalLen += len(terms)
+		}
+	}
+	if len(lengths) == 0 {
+		return
+	}
+	for term, fieldFreqs := range frequencies {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[string]map[string]int)
+		}
+		s.postings[term][o.UID] = fieldFreqs
+		s.docTerms[o.UID] = append(s.docTerms[o.UID], term)
+	}
+	s.docLen[o.UID] = lengths
+}
+
+// delete removes object from the search index.
+func (s *searchIndex) delete(uid string) {
+	if !s.enabled() {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(uid)
+}
+
+// search returns the bm25 relevance score of every object that contains at least one of the terms
+// of text, only the terms of fields that aren't hidden by rules are matched and scored.
+func (s *searchIndex) search(text string, rules fieldRules) map[string]float64 {
+	out := make(map[string]float64)
+	if !s.enabled() {
+		return out
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	docCount := float64(len(s.docLen))
+	if docCount == 0 {
+		return out
+	}
+	avgLen := float64(s.totalLen) / docCount
+	for _, term := range tokenizeSearchText(text) {
+		postings := s.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (docCount-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for uid, fieldFreqs := range postings {
+			tf := 0.0
+			for field, freq := range fieldFreqs {
+				if !rules.isHidden(field) {
+					tf += float64(freq)
+				}
+			}
+			if tf == 0 {
+				continue
+			}
+			docLen := 0
+			for field, n := range s.docLen[uid] {
+				if !rules.isHidden(field) {
+					docLen += n
+				}
+			}
+			norm := 1 - searchB + searchB*float64(docLen)/avgLen
+			out[uid] += idf * (tf * (searchK1 + 1)) / (tf + searchK1*norm)
+		}
+	}
+	return out
+}
+
+// reindexSearch updates the search index entries of the given objects from the store.
+func (c *Client) reindexSearch(uids []string) error {
+	if !c.search.enabled() {
+		return nil
+	}
+	for _, uid := range uids {
+		o := &types.Object{}
+		if err := c.getRaw(objectPrefix+uid, o); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				c.search.delete(uid)
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		c.search.set(o)
+	}
+	return nil
+}
+
+// Search returns objects whose searchable fields match text ordered by relevance. Results
+// can be further filtered with a query, pass an empty query to search every object.
+func (c *Client) Search(text string, q string, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	res, err := c.SearchContext(context.Background(), text, q, opts, u)
+	return res, errors.WithStack(err)
+}
+
+// SearchContext is Search that stops evaluating the filter query when ctx is done.
+func (c *Client) SearchContext(ctx context.Context, text string, q string, opts types.QueryOptions, u *types.User) (*QueryResult, error) {
+	if strings.TrimSpace(text) == "" || opts.Limit < 0 {
+		return nil, errors.WithStack(ErrInvalidArg)
+	}
+	if !c.search.enabled() {
+		return nil, errors.WithStack(ErrNotSupported)
+	}
+	// hidden fields aren't matched so their values can't be guessed from results
+	rules := c.getFieldRules(u)
+	acl := c.getACLReader(u)
+	scores := c.search.search(text, rules)
+	matches := make([]*types.IndexObject, 0, len(scores))
+	if q != "" {
+		if err := c.checkRawQuery(u); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		filtered, err := c.match(ctx, q, u)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, obj := range filtered {
+			if scores[obj.UID] > 0 {
+				matches = append(matches, obj)
+			}
+		}
+	} else {
+		c.indexSync.Lock()
+		for uid := range scores {
+			if i, exists := c.indexMap[uid]; exists {
+				matches = append(matches, c.index[i])
+			}
+		}
+		c.indexSync.Unlock()
+		allowed := make([]*types.IndexObject, 0, len(matches))
+		for _, obj := range matches {
+			if err := c.checkPermission(permList, u, obj); err != nil {
+				if errors.Is(err, ErrPermission) {
+					continue
+				}
+				return nil, errors.WithStack(err)
+			}
+			allowed = append(allowed, acl.stripIndex(rules.stripIndex(obj)))
+		}
+		matches = allowed
+	}
+	if len(opts.Sort) == 0 {
+		opts.Sort = []string{"-" + searchScoreField}
+	}
+	ctx, cancel := c.getQueryLimits(u).context(ctx)
+	defer cancel()
+	res, err := c.queryPage(ctx, matches, opts, u, map[string]map[string]float64{searchScoreField: scores})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res.Scores = scores
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestSearch(t *testing.T) {
+	c := &Config{}
+	c.Search.Fields = []string{"title", "body"}
+	c.UserGroups = map[string]UserGroup{
+		"reader": UserGroup{
+			Get: "public = true",
+		},
+	}
+	client := NewClient(c)
+	docs := []map[string]interface{}{
+		{"type": "kb", "public": true, "title": "Running servers", "body": "How to run the server in production."},
+		{"type": "kb", "public": true, "title": "Configuration", "body": "The server reads its configuration from config.yaml."},
+		{"type": "kb", "public": false, "title": "Secrets", "body": "The server password is stored in a vault."},
+		{"type": "page", "public": true, "title": "Cooking", "body": "Pasta recipes."},
+	}
+	uids := make([]string, 0)
+	for _, data := range docs {
+		o := &types.Object{Data: data}
+		client.Set(o, nil)
+		uids = append(uids, o.UID)
+	}
+
+	// stemmed terms match, most relevant first
+	res, err := client.Search("runs", "", types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 1 || res.Objects[0].UID != uids[0] {
+		t.Error("expected stemmed match")
+		return
+	}
+	res, err = client.Search("server configuration", "", types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 3 || res.Objects[0].UID != uids[1] {
+		t.Error("expected most relevant object first")
+		return
+	}
+	if res.API()[0]["_score"].(float64) <= res.API()[1]["_score"].(float64) {
+		t.Error("expected descending scores")
+	}
+
+	// combine with query filter
+	res, err = client.Search("server", "type = 'kb' and public = true", types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 2 {
+		t.Error("expected filtered search results")
+	}
+
+	// permission check
+	u := &types.User{UID: "reader", Groups: []string{"reader"}}
+	res, err = client.Search("password", "", types.QueryOptions{}, u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res.Objects) != 0 {
+		t.Error("expected search results to be permission checked")
+	}
+
+	// deleted objects are removed from search
+	client.Delete(&types.Object{UID: uids[3]}, nil)
+	res, _ = client.Search("pasta", "", types.QueryOptions{}, nil)
+	if len(res.Objects) != 0 {
+		t.Error("expected deleted object to be removed from search")
+	}
+
+	// hidden fields aren't matched
+	c = &Config{}
+	c.Search.Fields = []string{"title", "notes"}
+	c.UserGroups = map[string]UserGroup{
+		"reader": UserGroup{Get: true, HiddenFields: []string{"notes"}},
+	}
+	client = NewClient(c)
+	o := &types.Object{Data: map[string]interface{}{"title": "Invoice", "notes": "customer owes money"}}
+	client.Set(o, nil)
+	if res, _ := client.Search("money", "", types.QueryOptions{}, u); len(res.Objects) != 0 {
+		t.Error("expected hidden field to not be searched")
+	}
+	if res, _ := client.Search("invoice money", "", types.QueryOptions{}, u); len(res.Objects) != 1 {
+		t.Error("expected visible field to be searched")
+	}
+	if res, _ := client.Search("money", "", types.QueryOptions{}, nil); len(res.Objects) != 1 {
+		t.Error("expected hidden field to be searched by user it isn't hidden from")
+	}
+
+	// search requires configured fields
+	if _, err := NewClient(nil).Search("server", "", types.QueryOptions{}, nil); !errors.Is(err, ErrNotSupported) {
+		t.Error("expected not supported error")
+	}
+}
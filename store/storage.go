@@ -0,0 +1,355 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/file"
+	"github.com/philippgille/gokv/redis"
+	"github.com/philippgille/gokv/syncmap"
+	"github.com/pkg/errors"
+)
+
+const (
+	fileStoreExtension = ".json"
+	fileLockExtension  = ".lock"
+	// fileLockStale is the age after which a lock file left by a crashed client is removed
+	fileLockStale = 10 * time.Second
+	// updateRetries is the number of times an update conflicting with another client is retried
+	updateRetries = 100
+)
+
+// updateAction is what an update does with the key once the change is applied.
+type updateAction int
+
+const (
+	updateSkip updateAction = iota
+	updateSet
+	updateDelete
+)
+
+// keyLister is implemented by storage backends that can enumerate their keys.
+type keyLister interface {
+	Keys(prefix string) ([]string, error)
+}
+
+// keyUpdater is implemented by storage backends that can read, change and write a key
+// atomically across all clients sharing the storage.
+type keyUpdater interface {
+	Update(k string, v interface{}, change func(found bool) (updateAction, error)) error
+}
+
+// updateLock serializes updates of storage backends that don't implement keyUpdater.
+var updateLock sync.Mutex
+
+// memoryStore is a syncmap store that keeps track of its keys.
+type memoryStore struct {
+	syncmap.Store
+	keys       *sync.Map
+	updateLock sync.Mutex
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		Store: syncmap.NewStore(syncmap.DefaultOptions),
+		keys:  &sync.Map{},
+	}
+}
+
+// Set stores the given value for the given key.
+func (s *memoryStore) Set(k string, v interface{}) error {
+	if err := s.Store.Set(k, v); err != nil {
+		return err
+	}
+	s.keys.Store(k, true)
+	return nil
+}
+
+// Delete deletes the stored value for the given key.
+func (s *memoryStore) Delete(k string) error {
+	if err := s.Store.Delete(k); err != nil {
+		return err
+	}
+	s.keys.Delete(k)
+	return nil
+}
+
+// Update atomically reads the key into v, applies change and writes the result.
+func (s *memoryStore) Update(k string, v interface{}, change func(found bool) (updateAction, error)) error {
+	s.updateLock.Lock()
+	defer s.updateLock.Unlock()
+	return updateValue(s, k, v, change)
+}
+
+// Keys returns all stored keys that start with prefix.
+func (s *memoryStore) Keys(prefix string) ([]string, error) {
+	out := make([]string, 0)
+	s.keys.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			out = append(out, k.(string))
+		}
+		return true
+	})
+	sort.Strings(out)
+	return out, nil
+}
+
+// fileStore is a file store that can list the keys in its directory.
+type fileStore struct {
+	file.Store
+	directory string
+}
+
+func newFileStore(opts file.Options) (*fileStore, error) {
+	extension := strings.TrimPrefix(fileStoreExtension, ".")
+	opts.FilenameExtension = &extension
+	store, err := file.NewStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStore{
+		Store:     store,
+		directory: opts.Directory,
+	}, nil
+}
+
+// Set stores the given value for the given key. The value is written to a temporary file
+// that replaces the value file so that other processes never read a partial value.
+func (s *fileStore) Set(k string, v interface{}) error {
+	if k == "" || v == nil {
+		return s.Store.Set(k, v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp, err := ioutil.TempFile(s.directory, url.PathEscape(k)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), filepath.Join(s.directory, url.PathEscape(k)+fileStoreExtension)))
+}
+
+// Keys returns all stored keys that start with prefix.
+func (s *fileStore) Keys(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(s.directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	out := make([]string, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileStoreExtension) {
+			continue
+		}
+		k, err := url.PathUnescape(strings.TrimSuffix(f.Name(), fileStoreExtension))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Update atomically reads the key into v, applies change and writes the result,
+// a lock file next to the value file excludes other processes.
+func (s *fileStore) Update(k string, v interface{}, change func(found bool) (updateAction, error)) error {
+	if err := os.MkdirAll(s.directory, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	lockPath := filepath.Join(s.directory, url.PathEscape(k)+fileLockExtension)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return errors.WithStack(err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > fileLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer os.Remove(lockPath)
+	return updateValue(s, k, v, change)
+}
+
+// redisStore is a redis client that can scan keys.
+type redisStore struct {
+	redis.Client
+	scanClient *goredis.Client
+}
+
+func newRedisStore(opts redis.Options) (*redisStore, error) {
+	client, err := redis.NewClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Address == "" {
+		opts.Address = redis.DefaultOptions.Address
+	}
+	return &redisStore{
+		Client: client,
+		scanClient: goredis.NewClient(&goredis.Options{
+			Addr:     opts.Address,
+			Password: opts.Password,
+			DB:       opts.DB,
+		}),
+	}, nil
+}
+
+// Keys returns all stored keys that start with prefix.
+func (s *redisStore) Keys(prefix string) ([]string, error) {
+	out := make([]string, 0)
+	var cursor uint64
+	for {
+		keys, next, err := s.scanClient.Scan(cursor, prefix+"*", 1000).Result()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		out = append(out, keys...)
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Update atomically reads the key into v, applies change and writes the result,
+// the write is retried when another client changes the key in between.
+func (s *redisStore) Update(k string, v interface{}, change func(found bool) (updateAction, error)) error {
+	update := func(tx *goredis.Tx) error {
+		resetValue(v)
+		data, err := tx.Get(k).Bytes()
+		found := err == nil
+		if err != nil && err != goredis.Nil {
+			return errors.WithStack(err)
+		}
+		if found {
+			if err := json.Unmarshal(data, v); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		action, err := change(found)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case updateSet:
+			{
+				data, err := json.Marshal(v)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				_, err = tx.TxPipelined(func(pipe goredis.Pipeliner) error {
+					pipe.Set(k, data, 0)
+					return nil
+				})
+				return err
+			}
+		case updateDelete:
+			{
+				_, err := tx.TxPipelined(func(pipe goredis.Pipeliner) error {
+					pipe.Del(k)
+					return nil
+				})
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < updateRetries; i++ {
+		err := s.scanClient.Watch(update, k)
+		if err != goredis.TxFailedErr {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(goredis.TxFailedErr)
+}
+
+// Close closes the store.
+func (s *redisStore) Close() error {
+	s.scanClient.Close()
+	return s.Client.Close()
+}
+
+// listKeys returns all keys in store that start with prefix.
+func listKeys(s gokv.Store, prefix string) ([]string, error) {
+	lister, ok := s.(keyLister)
+	if !ok {
+		return nil, errors.WithStack(ErrNotSupported)
+	}
+	keys, err := lister.Keys(prefix)
+	return keys, errors.WithStack(err)
+}
+
+// updateKey reads the key into v, applies change and writes the result. The update is atomic
+// across clients when the storage backend supports it, otherwise only within this process.
+func updateKey(s gokv.Store, k string, v interface{}, change func(found bool) (updateAction, error)) error {
+	if updater, ok := s.(keyUpdater); ok {
+		return errors.WithStack(updater.Update(k, v, change))
+	}
+	updateLock.Lock()
+	defer updateLock.Unlock()
+	return errors.WithStack(updateValue(s, k, v, change))
+}
+
+// updateValue reads, changes and writes the key without any locking.
+func updateValue(s gokv.Store, k string, v interface{}, change func(found bool) (updateAction, error)) error {
+	resetValue(v)
+	found, err := s.Get(k, v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	action, err := change(found)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case updateSet:
+		{
+			return errors.WithStack(s.Set(k, v))
+		}
+	case updateDelete:
+		{
+			return errors.WithStack(s.Delete(k))
+		}
+	}
+	return nil
+}
+
+// resetValue sets the value v points to back to its zero value.
+func resetValue(v interface{}) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		value.Elem().Set(reflect.Zero(value.Elem().Type()))
+	}
+}
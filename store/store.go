@@ -1,13 +1,11 @@
 package store
 
 import (
-	"strings"
+	"fmt"
 	"sync"
 	"time"
 
-	"github.com/caibirdme/yql"
 	"github.com/philippgille/gokv"
-	"github.com/philippgille/gokv/syncmap"
 	"gitlab.com/contextualcode/go-object-store/types"
 
 	"github.com/pkg/errors"
@@ -17,16 +15,34 @@ const (
 	userPrefix     = "user_"
 	usernamePrefix = "username_"
 	objectPrefix   = "obj_"
-	indexName      = "index"
+	indexName      = "index" // legacy single key index, replaced by index shards
 )
 
 // Client is the key/value store interface.
 type Client struct {
-	store      gokv.Store
-	sync       sync.Mutex
-	index      []*types.IndexObject
-	indexSync  sync.Mutex
-	userGroups map[string]UserGroup
+	store        gokv.Store
+	sync         sync.Mutex
+	index        []*types.IndexObject
+	indexMap     map[string]int
+	indexSync    sync.Mutex
+	shardSync    sync.Mutex
+	search       *searchIndex
+	geo          *geoIndex
+	clock        *hybridClock
+	indexConfig  map[string]types.IndexConfig
+	slowQuery    time.Duration
+	savedQueries map[string]SavedQuery
+	// userGroups are the configured user groups merged with those managed in the store, guarded by userGroupsLock
+	userGroups        map[string]UserGroup
+	configUserGroups  map[string]UserGroup
+	userGroupsVersion string
+	userGroupsLock    sync.RWMutex
+	// shardVersions are the versions of the index shards last loaded, guarded by indexSync
+	shardVersions  map[string]string
+	syncStatus     SyncStatus
+	syncStatusLock sync.Mutex
+	syncStop       chan struct{}
+	rateLimiter    *rateLimiter
 }
 
 // NewClient creates a new object store client from given configuration.
@@ -34,27 +50,68 @@ func NewClient(c *Config) *Client {
 	if c == nil {
 		// use memory store by default
 		return &Client{
-			store:      syncmap.NewStore(syncmap.DefaultOptions),
-			userGroups: make(map[string]UserGroup),
+			store:            newMemoryStore(),
+			indexMap:         make(map[string]int),
+			geo:              newGeoIndex(),
+			clock:            newHybridClock(time.Now),
+			rateLimiter:      newRateLimiter(RateLimitConfig{}),
+			userGroups:       make(map[string]UserGroup),
+			configUserGroups: make(map[string]UserGroup),
 		}
 	}
 	s := &Client{
-		store:      c.storageClient(),
-		userGroups: c.UserGroups,
+		store:            c.storageClient(),
+		indexMap:         make(map[string]int),
+		search:           newSearchIndex(c.Search),
+		geo:              newGeoIndex(),
+		clock:            newHybridClock(time.Now),
+		rateLimiter:      newRateLimiter(c.RateLimit),
+		indexConfig:      c.Index,
+		slowQuery:        time.Duration(c.SlowQuery) * time.Millisecond,
+		savedQueries:     c.Queries,
+		configUserGroups: make(map[string]UserGroup, len(c.UserGroups)),
+	}
+	for name, userGroup := range c.UserGroups {
+		if err := userGroup.compile(); err != nil {
+			logWarnErr(err, fmt.Sprintf("user group %s is invalid", name))
+		}
+		s.configUserGroups[name] = userGroup
+	}
+	s.userGroups = s.mergeUserGroups(nil)
+	if err := checkUserGroups(s.userGroups); err != nil {
+		logWarnErr(err, "user groups are invalid")
+	}
+	for name, q := range s.savedQueries {
+		if err := q.validate(); err != nil {
+			logWarnErr(err, fmt.Sprintf("saved query %s is invalid", name))
+		}
+	}
+	// load index
+	if err := s.Sync(); err != nil {
+		logWarnErr(err, "index load error")
 	}
 	return s
 }
 
 func (c *Client) getUserGroups(u *types.User) []UserGroup {
 	out := make([]UserGroup, 0)
+	for _, userGroup := range c.getNamedUserGroups(u) {
+		out = append(out, userGroup.UserGroup)
+	}
+	return out
+}
+
+// getNamedUserGroups returns the groups of user, followed by the groups they inherit.
+func (c *Client) getNamedUserGroups(u *types.User) []NamedUserGroup {
+	out := make([]NamedUserGroup, 0)
 	if u == nil {
 		return out
 	}
-	for k, v := range c.userGroups {
-		for _, name := range u.Groups {
-			if name == k {
-				out = append(out, v)
-			}
+	userGroups := c.getUserGroupMap()
+	for _, name := range userGroupNames(userGroups, u.Groups) {
+		if userGroup, exists := userGroups[name]; exists {
+			_, config := c.configUserGroups[name]
+			out = append(out, NamedUserGroup{Name: name, Config: config, UserGroup: userGroup})
 		}
 	}
 	return out
@@ -70,133 +127,68 @@ func (c *Client) getRaw(k string, o interface{}) error {
 	return nil
 }
 
-func (s *Client) addIndex(o *types.IndexObject) {
-	s.indexSync.Lock()
-	defer s.indexSync.Unlock()
-	for i := range s.index {
-		if s.index[i].UID == o.UID {
-			s.index[i] = o
-			return
-		}
-	}
-	s.index = append(s.index, o)
-}
-
-func (s *Client) deleteIndex(o *types.Object) {
-	s.indexSync.Lock()
-	defer s.indexSync.Unlock()
-	for i := range s.index {
-		if s.index[i].UID == o.UID {
-			s.index = append(s.index[:i], s.index[i+1:]...)
-			break
-		}
-	}
-}
-
-func (s *Client) commitIndex() error {
-	s.indexSync.Lock()
-	defer s.indexSync.Unlock()
-	if err := s.store.Set(indexName, s.index); err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+func (s *Client) checkPermission(perm string, u *types.User, o *types.IndexObject) error {
+	return s.explainPermission(perm, u, o, nil)
 }
 
-func (s *Client) checkPermission(perm string, u *types.User, o *types.IndexObject) error {
+// explainPermission checks permission of user on object, recording the steps that decided it in explain when not nil.
+func (s *Client) explainPermission(perm string, u *types.User, o *types.IndexObject, explain *PermissionExplain) error {
 	if o == nil {
 		return errors.WithStack(ErrMissingObject)
 	}
 	if u == nil {
+		explain.step(perm, permStepTrusted, "", nil, true)
 		return nil
 	}
-	// if user is author then they can 'get' the object
-	if perm == permGet && u.UID != "" && o.Author == u.UID {
-		return nil
-	}
-	// itterate groups and see if any allow permission
-	userGroups := s.getUserGroups(u)
+	// deny rules take precedence over everything that allows access
+	userGroups := s.getNamedUserGroups(u)
+	variables := s.queryVariables(u)
 	for _, userGroup := range userGroups {
-		match, err := userGroup.check(perm, o)
+		denied, err := userGroup.denies(perm, o, variables)
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		if match {
-			return nil
+		if rule := userGroup.getDeny(perm); rule != nil {
+			explain.step(perm, permStepDeny, userGroup.Name, rule, denied)
+		}
+		if denied {
+			return errors.WithStack(ErrPermission)
 		}
 	}
-	// if user owns object then they are allowed to update it provided they have 'set' permission
-	if perm == permUpdate && o.Author == u.UID {
-		return s.checkPermission(permSet, u, o)
-	}
-	return errors.WithStack(ErrPermission)
-}
-
-// Sync syncs the local memory index with the remote store index.
-func (s *Client) Sync() error {
-	s.indexSync.Lock()
-	defer s.indexSync.Unlock()
-	remoteIndex := make([]*types.IndexObject, 0)
-	if err := s.getRaw(indexName, &remoteIndex); err != nil {
-		if !errors.Is(err, ErrNotFound) {
-			return errors.WithStack(err)
+	// if user is author then they can 'get' and 'list' the object
+	if perm == permGet || perm == permList {
+		isAuthor := u.UID != "" && o.Author == u.UID
+		explain.step(perm, permStepAuthor, "", nil, isAuthor)
+		if isAuthor {
+			return nil
 		}
 	}
-	hasChange := false
-	// check if remote index has items that local does not and check if matching items have been modified
-	for _, remoteIndexItem := range remoteIndex {
-		hasLocal := false
-		for i, localIndexItem := range s.index {
-			if localIndexItem.UID == remoteIndexItem.UID {
-				hasLocal = true
-				if remoteIndexItem.Modified.After(localIndexItem.Modified) {
-					s.index[i] = remoteIndexItem
-					continue
-				}
-				hasChange = true
-			}
+	// itterate groups and see if any allow permission
+	for _, userGroup := range userGroups {
+		match, err := userGroup.check(perm, o, variables)
+		if err != nil {
+			return errors.WithStack(err)
 		}
-		if !hasLocal {
-			hasChange = true
-			s.index = append(s.index, remoteIndexItem)
+		explain.step(perm, permStepGroup, userGroup.Name, userGroup.getPerm(perm), match)
+		if match {
+			return nil
 		}
 	}
-	// check if local index has items that remote does not
-	if !hasChange {
-		for _, localIndexItem := range s.index {
-			hasItem := false
-			for _, remoteIndexItem := range remoteIndex {
-				if localIndexItem.UID == remoteIndexItem.UID {
-					hasItem = true
-					break
-				}
-			}
-			if !hasItem {
-				hasChange = true
-				break
-			}
-		}
+	// object may be shared with user or one of their groups
+	shared := checkACL(perm, u, o)
+	explain.step(perm, permStepACL, "", o.ACL, shared)
+	if shared {
+		return nil
 	}
-	// update remote only if local has changes
-	if hasChange {
-		s.indexSync.Unlock()
-		err := s.commitIndex()
-		s.indexSync.Lock()
-		if err != nil {
-			return errors.WithStack(err)
+	// if user owns object then they are allowed to update and delete it provided they have 'set' permission
+	if perm == permUpdate || perm == permDelete {
+		isAuthor := o.Author == u.UID
+		explain.step(perm, permStepAuthor, "", nil, isAuthor)
+		if isAuthor {
+			return s.explainPermission(permSet, u, o, explain)
 		}
 	}
-	return nil
-}
-
-// Index returns index data.
-func (c *Client) Index() ([]types.IndexObject, error) {
-	c.indexSync.Lock()
-	defer c.indexSync.Unlock()
-	out := make([]types.IndexObject, 0)
-	for _, o := range c.index {
-		out = append(out, *o)
-	}
-	return out, nil
+	return errors.WithStack(ErrPermission)
 }
 
 // Get retrieves object from store.
@@ -205,9 +197,13 @@ func (c *Client) Get(uid string, u *types.User) (*types.Object, error) {
 	if err := c.getRaw(objectPrefix+uid, o); err != nil {
 		return nil, errors.WithStack(err)
 	}
-	if err := c.checkPermission(permGet, u, o.Index()); err != nil {
+	if err := c.checkPermission(permGet, u, c.indexObject(o)); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	o.Data = c.getFieldRules(u).strip(o.Data)
+	if !c.getACLReader(u).visible(o.Author) {
+		o.ACL = nil
+	}
 	return o, nil
 }
 
@@ -225,94 +221,115 @@ func (c *Client) Set(o *types.Object, u *types.User) error {
 		if u != nil {
 			o.Author = u.UID
 		}
-		o.Created = time.Now()
+		o.Created = c.clock.time()
 	}
 	defer c.sync.Unlock()
 	c.sync.Lock()
+	var existingObj *types.Object
+	if !isNew {
+		var err error
+		existingObj, err = c.Get(o.UID, nil)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return errors.WithStack(err)
+		}
+	}
 	// check against previous existing object
 	if u != nil {
-		var existingObj *types.Object
-		if !isNew {
-			var err error
-			existingObj, err = c.Get(o.UID, nil)
-			if err != nil && !errors.Is(err, ErrNotFound) {
-				return errors.WithStack(err)
-			}
+		if err := c.getFieldRules(u).checkWrite(o, existingObj); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := c.checkACLWrite(u, o, existingObj); err != nil {
+			return errors.WithStack(err)
 		}
-		if existingObj == nil || isNew {
-			// if no existing object then use 'set' permission
-			if err := c.checkPermission(permSet, u, o.Index()); err != nil {
+		if existingObj == nil {
+			// new object, possibly with a uid chosen by the user, is authored by them
+			o.Author = u.UID
+			if !isNew {
+				o.Created = c.clock.time()
+			}
+			if err := c.checkPermission(permSet, u, c.indexObject(o)); err != nil {
 				return errors.WithStack(err)
 			}
-		} else if existingObj != nil {
+		} else {
+			// author and created aren't allowed to be changed, so update rules see the stored author
+			o.Author = existingObj.Author
+			o.Created = existingObj.Created
 			// if existing object then use 'update' permission
-			if err := c.checkPermission(permUpdate, u, existingObj.Index()); err != nil {
+			if err := c.checkPermission(permUpdate, u, c.indexObject(existingObj)); err != nil {
 				return errors.WithStack(err)
 			}
-			if err := c.checkPermission(permUpdate, u, o.Index()); err != nil {
+			if err := c.checkPermission(permUpdate, u, c.indexObject(o)); err != nil {
 				return errors.WithStack(err)
 			}
-			// author and created aren't allowed to be changed
-			o.Author = existingObj.Author
-			o.Created = existingObj.Created
+			c.clock.observe(existingObj.HLC)
 		}
 	}
-	o.Modified = time.Now()
+	if u == nil && existingObj != nil && o.ACL == nil {
+		// keep the stored access control list
+		o.ACL = existingObj.ACL
+	}
+	o.Modified = c.clock.time()
+	o.HLC = c.clock.stamp()
 	o.Modifier = ""
 	if u != nil {
 		o.Modifier = u.UID
 	}
+	// usage is reserved before the write so the quota can't be overrun by concurrent writes
+	if err := c.updateUsage(u, o, existingObj); err != nil {
+		return errors.WithStack(err)
+	}
 	if err := c.store.Set(objectPrefix+o.UID, o); err != nil {
+		if err := c.updateUsage(nil, existingObj, o); err != nil {
+			logWarnErr(err, "failed to revert usage")
+		}
 		return errors.WithStack(err)
 	}
-	c.addIndex(o.Index())
+	indexObj := c.indexObject(o)
+	c.addIndex(indexObj)
+	c.search.set(o)
+	if err := c.commitIndexObject(o.UID, indexObj); err != nil {
+		return errors.WithStack(err)
+	}
+	o.Data = c.getFieldRules(u).strip(o.Data)
+	if !c.getACLReader(u).visible(o.Author) {
+		o.ACL = nil
+	}
 	return nil
 }
 
-// Delete deletes object from store.
+// Delete deletes object from store, permission is checked against the stored object so only its uid is needed.
 func (c *Client) Delete(o *types.Object, u *types.User) error {
+	if o == nil {
+		return errors.WithStack(ErrMissingObject)
+	}
 	if o.UID == "" {
 		return errors.WithStack(ErrMissingUID)
 	}
-	if err := c.checkPermission(permDelete, u, o.Index()); err != nil {
-		return errors.WithStack(err)
-	}
 	defer c.sync.Unlock()
 	c.sync.Lock()
-	if err := c.store.Delete(objectPrefix + o.UID); err != nil {
+	existingObj := &types.Object{}
+	if err := c.getRaw(objectPrefix+o.UID, existingObj); err != nil {
 		return errors.WithStack(err)
 	}
-	c.deleteIndex(o)
-	o.UID = ""
-	return nil
-}
-
-// Query returns indexed objects based on provided query match.
-func (c *Client) Query(q string, u *types.User) ([]types.IndexObject, error) {
-	ruler, err := yql.Rule(q)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	if err := c.checkPermission(permDelete, u, c.indexObject(existingObj)); err != nil {
+		return errors.WithStack(err)
 	}
-	out := make([]types.IndexObject, 0)
-	for _, obj := range c.index {
-		match, err := ruler.Match(obj.QueryMap())
-		if err != nil {
-			if strings.Contains(err.Error(), "not provided") {
-				continue
-			}
-			return nil, errors.WithStack(err)
-		}
-		if match {
-			if err := c.checkPermission(permGet, u, obj); err != nil {
-				if errors.Is(err, ErrPermission) {
-					continue
-				}
-				return nil, errors.WithStack(err)
-			}
-			out = append(out, *obj)
+	if err := c.updateUsage(nil, nil, existingObj); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := c.store.Delete(objectPrefix + o.UID); err != nil {
+		if err := c.updateUsage(nil, existingObj, nil); err != nil {
+			logWarnErr(err, "failed to revert usage")
 		}
+		return errors.WithStack(err)
+	}
+	c.deleteIndex(o.UID)
+	c.search.delete(o.UID)
+	if err := c.commitIndexObject(o.UID, nil); err != nil {
+		return errors.WithStack(err)
 	}
-	return out, nil
+	o.UID = ""
+	return nil
 }
 
 // GetUser retrieves user from store.
@@ -334,6 +351,15 @@ func (c *Client) GetUserByUsername(username string) (*types.User, error) {
 	return u, nil
 }
 
+// FindUser retrieves user from store by their username or uid.
+func (c *Client) FindUser(name string) (*types.User, error) {
+	u, err := c.GetUserByUsername(name)
+	if errors.Is(err, ErrNotFound) {
+		u, err = c.GetUser(name)
+	}
+	return u, errors.WithStack(err)
+}
+
 // SetUser stores given user.
 func (c *Client) SetUser(u *types.User) error {
 	// require a username
@@ -343,8 +369,8 @@ func (c *Client) SetUser(u *types.User) error {
 	// generate user id if not exists
 	if u.UID == "" {
 		u.UID = generateObjectUID()
-		u.Created = time.Now()
-		u.Modified = time.Now()
+		u.Created = c.clock.time()
+		u.Modified = c.clock.time()
 		u.Active = true
 	}
 	defer c.sync.Unlock()
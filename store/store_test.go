@@ -1,9 +1,18 @@
 package store
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
 	"math/rand"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/philippgille/gokv/file"
 	"github.com/pkg/errors"
 	"gitlab.com/contextualcode/go-object-store/types"
 )
@@ -53,6 +62,50 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeletePermission(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"editor": {Get: true, Set: true, Delete: "type = 'draft'"},
+		},
+	})
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	other := &types.User{UID: "other", Groups: []string{"editor"}}
+	draft := &types.Object{Data: map[string]interface{}{"type": "draft"}}
+	page := &types.Object{Data: map[string]interface{}{"type": "page"}}
+	for _, o := range []*types.Object{draft, page} {
+		if err := client.Set(o, editor); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// rules are evaluated against the stored object, not the payload
+	if err := client.Delete(&types.Object{UID: page.UID, Data: map[string]interface{}{"type": "draft"}}, other); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+	if err := client.Delete(&types.Object{UID: draft.UID}, other); err != nil {
+		t.Error(err)
+	}
+	if err := client.Delete(&types.Object{UID: draft.UID}, other); !errors.Is(err, ErrNotFound) {
+		t.Error("expected not found error")
+	}
+	// authors can delete their objects with 'set' permission, as with updates
+	if err := client.Delete(&types.Object{UID: page.UID}, editor); err != nil {
+		t.Error(err)
+	}
+
+	// authors can't be spoofed by the payload of an update
+	o := &types.Object{Data: map[string]interface{}{"type": "page"}}
+	client.Set(o, editor)
+	if err := client.Set(&types.Object{UID: o.UID, Author: other.UID, Data: o.Data}, other); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+	// objects created with a chosen uid are authored by the user
+	chosen := &types.Object{UID: "chosen", Author: editor.UID, Data: map[string]interface{}{"type": "page"}}
+	if err := client.Set(chosen, other); err != nil || chosen.Author != other.UID {
+		t.Error("expected user to author object")
+	}
+}
+
 func TestIndexSet(t *testing.T) {
 	client := NewClient(nil)
 	o := &types.Object{
@@ -230,34 +283,520 @@ func TestSyncIndex(t *testing.T) {
 		return
 	}
 
-	// store object and sync index
+	// second client sharing the same storage
+	client2 := NewClient(nil)
+	client2.store = client.store
+	if err := client2.Sync(); err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ := client2.Index()
+	if len(index) != 1 || index[0].Data["test_string"] != "hello world" {
+		t.Error("unexpected value in synced index")
+		return
+	}
+
+	// update object, shard should be written without sync
+	o.Data["test_string"] = "hello world two"
 	client.Set(o, nil)
+	shard, err := client.getIndexShard(indexShardKey(o.UID))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if shard.Objects[o.UID] == nil || shard.Objects[o.UID].Data["test_string"] != "hello world two" {
+		t.Error("unexpected value in remote index")
+		return
+	}
+
+	// second client keeps old value until sync
+	index, _ = client2.Index()
+	if index[0].Data["test_string"] != "hello world" {
+		t.Error("unexpected value in local index")
+	}
+	client2.Sync()
+	index, _ = client2.Index()
+	if index[0].Data["test_string"] != "hello world two" {
+		t.Error("unexpected value in synced index")
+	}
+
+	// delete on first client is removed from second client on sync
+	client.Delete(&types.Object{UID: o.UID}, nil)
+	client2.Sync()
+	index, _ = client2.Index()
+	if len(index) != 0 {
+		t.Error("expected deleted object to be removed from synced index")
+	}
+
+}
+
+func TestConcurrentIndexCommit(t *testing.T) {
+	// two clients sharing the same storage writing to the same shards
+	client := NewClient(nil)
+	client2 := NewClient(nil)
+	client2.store = client.store
+	count := 500
+	var wg sync.WaitGroup
+	for _, c := range []*Client{client, client2} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				if err := c.Set(&types.Object{Data: map[string]interface{}{"test": i}}, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// every write from both clients should be in the shards
+	client3 := NewClient(nil)
+	client3.store = client.store
+	if err := client3.Sync(); err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ := client3.Index()
+	if len(index) != count*2 {
+		t.Errorf("expected %d objects in synced index, got %d", count*2, len(index))
+	}
+}
+
+func TestSyncLegacyIndex(t *testing.T) {
+	client := NewClient(nil)
+	o := &types.Object{
+		UID: "legacy",
+		Data: map[string]interface{}{
+			"test_string": "hello world",
+		},
+	}
+	client.store.Set(objectPrefix+o.UID, o)
+	client.store.Set(indexName, []*types.IndexObject{o.Index()})
 	if err := client.Sync(); err != nil {
 		t.Error(err)
 		return
 	}
+	res, err := client.Query("test_string = 'hello world'", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0].UID != o.UID {
+		t.Error("expected legacy index to be loaded")
+		return
+	}
+	if found, _ := client.store.Get(indexName, &[]*types.IndexObject{}); found {
+		t.Error("expected legacy index to be removed")
+	}
+}
 
-	// update object without sync
-	o.Data["test_string"] = "hello world two"
+func TestQuerySortPaginate(t *testing.T) {
+	client := NewClient(nil)
+	for i := 0; i < 25; i++ {
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"type":  "page",
+				"views": i % 5,
+				"name":  string(byte(65 + i)),
+			},
+		}, nil)
+	}
+	opts := types.QueryOptions{
+		Sort:  []string{"-views", "name"},
+		Limit: 10,
+		Total: true,
+	}
+	seen := make(map[string]bool)
+	var last *types.IndexObject
+	pages := 0
+	for {
+		res, err := client.QueryWithOptions("type = 'page'", opts, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		pages++
+		if res.Total != 25 {
+			t.Error("unexpected total")
+			return
+		}
+		for i := range res.Objects {
+			o := res.Objects[i]
+			if seen[o.UID] {
+				t.Error("object returned twice")
+				return
+			}
+			seen[o.UID] = true
+			if last != nil {
+				if last.Data["views"].(float64) < o.Data["views"].(float64) {
+					t.Error("expected descending views")
+					return
+				}
+				if last.Data["views"] == o.Data["views"] && last.Data["name"].(string) > o.Data["name"].(string) {
+					t.Error("expected ascending names")
+					return
+				}
+			}
+			last = &o
+		}
+		if res.Cursor == "" {
+			break
+		}
+		opts.Cursor = res.Cursor
+	}
+	if pages != 3 || len(seen) != 25 {
+		t.Error("unexpected pagination")
+	}
+
+	// cursor is tied to its sort order
+	opts.Sort = []string{"name"}
+	if _, err := client.QueryWithOptions("type = 'page'", opts, nil); !errors.Is(err, ErrInvalidCursor) {
+		t.Error("expected invalid cursor error")
+	}
+}
+
+func TestQueryFullFields(t *testing.T) {
+	client := NewClient(nil)
+	o := &types.Object{
+		Data: map[string]interface{}{
+			"type":    "article",
+			"title":   "Hello",
+			"body":    strings.Repeat("a", types.IndexValueMaxSize*2),
+			"address": map[string]interface{}{"city": "London"},
+		},
+	}
 	client.Set(o, nil)
 
-	// fetch remote index prior to sync to ensure
-	// old value still remains
-	remoteIndex := make([]*types.IndexObject, 0)
-	client.getRaw(indexName, &remoteIndex)
-	if len(remoteIndex) == 0 {
-		t.Error("unexpected remote index length")
+	// index objects are truncated
+	res, err := client.QueryWithOptions("type = 'article'", types.QueryOptions{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
 	}
-	if remoteIndex[0].Data["test_string"] != "hello world" {
-		t.Error("unexpected value in remote index")
+	apiObjs := res.API()
+	if len(apiObjs) != 1 || len(apiObjs[0]["body"].(string)) != types.IndexValueMaxSize || apiObjs[0]["address"] != nil {
+		t.Error("expected index object")
+		return
 	}
 
-	// sync and ensure remote index is now updated
+	// full objects
+	res, err = client.QueryWithOptions("type = 'article'", types.QueryOptions{Full: true}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiObjs = res.API()
+	if len(apiObjs) != 1 || apiObjs[0]["body"] != o.Data["body"] || apiObjs[0]["address"] == nil {
+		t.Error("expected full object")
+		return
+	}
+
+	// projection
+	res, err = client.QueryWithOptions("type = 'article'", types.QueryOptions{Full: true, Fields: []string{"title", "address"}}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiObjs = res.API()
+	if len(apiObjs[0]) != 3 || apiObjs[0]["_uid"] != o.UID || apiObjs[0]["title"] != "Hello" || apiObjs[0]["address"] == nil {
+		t.Error("unexpected projected object")
+	}
+}
+
+func TestQueryFullPaginate(t *testing.T) {
+	client := NewClient(nil)
+	uids := make([]string, 0)
+	for i := 0; i < 6; i++ {
+		o := &types.Object{Data: map[string]interface{}{"type": "article", "order": i}}
+		client.Set(o, nil)
+		uids = append(uids, o.UID)
+	}
+	// stored objects removed behind the index's back
+	client.store.Delete(objectPrefix + uids[0])
+	client.store.Delete(objectPrefix + uids[3])
+
+	opts := types.QueryOptions{Full: true, Total: true, Limit: 2, Sort: []string{"order"}}
+	seen := make([]string, 0)
+	for page := 0; ; page++ {
+		res, err := client.QueryWithOptions("type = 'article'", opts, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// the total counts the index, only the page is loaded
+		if res.Total != 6 {
+			t.Errorf("expected total of 6, got %d", res.Total)
+			return
+		}
+		if len(res.Full) != len(res.Objects) || (res.Cursor != "" && len(res.Full) != 2) {
+			t.Errorf("unexpected page size %d", len(res.Full))
+			return
+		}
+		for _, o := range res.Full {
+			seen = append(seen, o.UID)
+		}
+		if res.Cursor == "" || page > 3 {
+			break
+		}
+		opts.Cursor = res.Cursor
+	}
+	if len(seen) != 4 || seen[0] != uids[1] || seen[2] != uids[4] {
+		t.Error("unexpected paginated objects")
+	}
+
+	// loading stops when the query is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	index, _ := client.Index()
+	matches := make([]*types.IndexObject, 0)
+	for i := range index {
+		matches = append(matches, &index[i])
+	}
+	if _, err := client.queryPage(ctx, matches, types.QueryOptions{Full: true, Limit: 2}, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Error("expected canceled error")
+	}
+}
+
+func TestQueryExplain(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"reader": {Get: "public = true"},
+		},
+	})
+	client.slowQuery = time.Nanosecond
+	for i := 0; i < 6; i++ {
+		client.Set(&types.Object{
+			Data: map[string]interface{}{
+				"type":   "explain",
+				"public": i%2 == 0,
+			},
+		}, nil)
+	}
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "other"}}, nil)
+	logOut := &bytes.Buffer{}
+	log.SetOutput(logOut)
+	defer log.SetOutput(os.Stderr)
+
+	u := &types.User{UID: "reader_uid", Username: "reader", Groups: []string{"reader"}}
+	res, err := client.QueryWithOptions("type = 'explain' and public != false or type = 'explain'", types.QueryOptions{Explain: true, Limit: 2}, u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if res.Explain == nil {
+		t.Error("expected explain")
+		return
+	}
+	e := res.Explain
+	if e.Index != explainIndexScan || e.Scanned != 7 || e.Matched != 6 || e.Denied != 3 || e.Returned != 2 {
+		t.Errorf("unexpected explain %+v", e)
+	}
+	if _, ok := e.Tree["or"]; !ok {
+		t.Error("expected or at the root of the parse tree")
+	}
+	if !strings.Contains(logOut.String(), "slow query by reader") {
+		t.Error("expected slow query to be logged")
+	}
+
+	// explain is only returned when requested
+	res, err = client.QueryWithOptions("type = 'explain'", types.QueryOptions{}, u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if res.Explain != nil {
+		t.Error("expected no explain")
+	}
+}
+
+func TestSyncChanges(t *testing.T) {
+	client := NewClient(nil)
+	client2 := NewClient(nil)
+	client2.store = client.store
+	objs := make([]*types.Object, 0)
+	for i := 0; i < 3; i++ {
+		o := &types.Object{Data: map[string]interface{}{"type": "sync", "n": i}}
+		client.Set(o, nil)
+		objs = append(objs, o)
+	}
+	// first incremental sync falls back to a full sync
+	if err := client2.SyncChanges(); err != nil {
+		t.Error(err)
+		return
+	}
+	if status := client2.SyncStatus(); status.Syncs != 1 || status.Shards != indexShardCount {
+		t.Errorf("unexpected sync status %+v", status)
+	}
+
+	// only the shards changed since the last sync are reloaded
+	objs[0].Data["n"] = 10
+	client.Set(objs[0], nil)
+	client.Delete(&types.Object{UID: objs[1].UID}, nil)
+	if err := client2.SyncChanges(); err != nil {
+		t.Error(err)
+		return
+	}
+	if status := client2.SyncStatus(); status.Shards > 2 || status.Lag() > time.Second {
+		t.Errorf("unexpected sync status %+v", status)
+	}
+	res, _ := client2.Query("type = 'sync'", nil)
+	if len(res) != 2 {
+		t.Error("expected deleted object to be removed")
+	}
+	if res, _ := client2.Query("n = 10", nil); len(res) != 1 {
+		t.Error("expected updated object")
+	}
+	client2.SyncChanges()
+	if status := client2.SyncStatus(); status.Shards != 0 {
+		t.Error("expected no shard to be reloaded")
+	}
+
+	// concurrent changes with the same modification time resolve the same way on every client
+	a := &types.IndexObject{UID: "x", Modified: time.Unix(100, 0), Modifier: "a"}
+	b := &types.IndexObject{UID: "x", Modified: time.Unix(100, 0), Modifier: "b"}
+	if newerIndexObject(a, b) || !newerIndexObject(b, a) {
+		t.Error("expected modifier to break ties")
+	}
+
+	// background sync picks up changes
+	client2.StartSync(SyncConfig{Interval: 10})
+	defer client2.StopSync()
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "sync"}}, nil)
+	time.Sleep(100 * time.Millisecond)
+	if res, _ := client2.Query("type = 'sync'", nil); len(res) != 3 {
+		t.Error("expected background sync to load new object")
+	}
+}
+
+func TestConcurrentIndexVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	newClient := func() *Client {
+		c := NewClient(nil)
+		opts := file.DefaultOptions
+		opts.Directory = dir
+		store, err := newFileStore(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.store = store
+		return c
+	}
+	// clients with their own file store over the same directory, as separate processes would
+	client := newClient()
+	client2 := newClient()
+	client3 := newClient()
+	client.Set(&types.Object{Data: map[string]interface{}{"test": -1}}, nil)
+	if err := client3.SyncChanges(); err != nil {
+		t.Error(err)
+		return
+	}
+	count := 20
+	var wg sync.WaitGroup
+	for _, c := range []*Client{client, client2} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				if err := c.Set(&types.Object{Data: map[string]interface{}{"test": i}}, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// an incremental sync sees every changed shard
+	if err := client3.SyncChanges(); err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ := client3.Index()
+	if len(index) != count*2+1 {
+		t.Errorf("expected %d objects in synced index, got %d", count*2+1, len(index))
+	}
+}
+
+func TestHybridClock(t *testing.T) {
+	now := time.Unix(1000, 0)
+	client := NewClient(nil)
+	client.SetClock(func() time.Time { return now })
+	o := &types.Object{Data: map[string]interface{}{"type": "clock", "value": "first"}}
+	client.Set(o, nil)
+	first := o.HLC
+	// clock standing still or going backwards still orders writes
+	client.Set(o, nil)
+	if o.HLC.Compare(first) <= 0 || o.HLC.Logical != 1 {
+		t.Errorf("expected logical counter to advance, got %+v", o.HLC)
+	}
+	now = now.Add(-time.Minute)
+	client.Set(o, nil)
+	if o.HLC.Compare(first) <= 0 || o.HLC.Wall != first.Wall {
+		t.Errorf("expected clock not to go backwards, got %+v", o.HLC)
+	}
+
+	// second client with a clock an hour behind wins when it writes after seeing the first write
+	client2 := NewClient(nil)
+	client2.store = client.store
+	client2.SetClock(func() time.Time { return time.Unix(1000, 0).Add(-time.Hour) })
+	client2.Sync()
+	o2, err := client2.Get(o.UID, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	o2.Data["value"] = "second"
+	client2.Set(o2, nil)
+	if !o2.Modified.Before(o.Modified) || o2.HLC.Compare(o.HLC) <= 0 {
+		t.Error("expected write to be ordered after the first one despite the clock skew")
+	}
 	client.Sync()
-	remoteIndex = make([]*types.IndexObject, 0)
-	client.getRaw(indexName, &remoteIndex)
-	if remoteIndex[0].Data["test_string"] != "hello world two" {
-		t.Error("unexpected value in remote index")
+	res, _ := client.Query("type = 'clock'", nil)
+	if len(res) != 1 || res[0].Data["value"] != "second" {
+		t.Error("expected last write to win")
+	}
+
+	// writes can be ordered by hybrid logical clock
+	other := &types.Object{Data: map[string]interface{}{"type": "clock", "value": "third"}}
+	client2.Set(other, nil)
+	page, err := client2.QueryWithOptions("type = 'clock' and _hlc > '"+o.HLC.String()+"'", types.QueryOptions{Sort: []string{"-_hlc"}}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(page.Objects) != 2 || page.Objects[0].UID != other.UID {
+		t.Error("expected objects ordered by hybrid logical clock")
+	}
+
+	// an older write committed late doesn't replace the newer shard entry
+	newer := client.indexObject(o2)
+	older := *newer
+	older.HLC = first
+	older.Data = map[string]interface{}{"type": "clock", "value": "stale"}
+	if err := client.commitIndexObject(o.UID, &older); err != nil {
+		t.Error(err)
+		return
+	}
+	shard, _ := client.getIndexShard(indexShardKey(o.UID))
+	if shard.Objects[o.UID].Data["value"] != "second" {
+		t.Error("expected newer shard entry to be kept")
 	}
 
+	// 'now()' is the time of the client clock
+	client.Set(&types.Object{Data: map[string]interface{}{"type": "event", "publish_at": "2021-01-01T00:00:00Z"}}, nil)
+	client.SetClock(func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) })
+	if res, _ := client.Query("type = 'event' and publish_at <= now()", nil); len(res) != 0 {
+		t.Error("expected event to be in the future of the client clock")
+	}
+	client.SetClock(func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) })
+	if res, _ := client.Query("type = 'event' and publish_at <= now() - 30d", nil); len(res) != 1 {
+		t.Error("expected event to be in the past of the client clock")
+	}
 }
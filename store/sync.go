@@ -0,0 +1,238 @@
+package store
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// indexVersionsName is the key of the manifest holding the version of every index shard,
+// clients compare it to the versions they last loaded to only reload changed shards.
+const indexVersionsName = "index_versions"
+
+// SyncConfig defines the background index synchronization.
+type SyncConfig struct {
+	Interval  int `yaml:"interval_ms"` // milliseconds between incremental syncs, zero to disable
+	FullEvery int `yaml:"full_every"`  // run a full sync every this many incremental syncs, zero to never
+}
+
+// indexVersion is the version of an index shard.
+type indexVersion struct {
+	Version  string    `json:"version"`
+	Modified time.Time `json:"modified"`
+}
+
+// SyncStatus reports the state of index synchronization.
+type SyncStatus struct {
+	LastSync time.Time // time of the last successful sync
+	Syncs    int       // number of successful syncs
+	Errors   int       // number of failed syncs
+	Shards   int       // number of shards reloaded by the last sync
+}
+
+// Lag returns how long ago the local index was last synced with the store.
+func (s SyncStatus) Lag() time.Duration {
+	if s.LastSync.IsZero() {
+		return 0
+	}
+	return time.Since(s.LastSync)
+}
+
+// newerIndexObject returns true if a replaces b. The last writer by hybrid logical clock wins,
+// entries written before objects were stamped fall back to modification time and modifier.
+func newerIndexObject(a *types.IndexObject, b *types.IndexObject) bool {
+	if !a.HLC.IsZero() || !b.HLC.IsZero() {
+		return a.HLC.Compare(b.HLC) > 0
+	}
+	if !a.Modified.Equal(b.Modified) {
+		return a.Modified.After(b.Modified)
+	}
+	return a.Modifier > b.Modifier
+}
+
+func (c *Client) getIndexVersions() (map[string]indexVersion, error) {
+	out := make(map[string]indexVersion)
+	if err := c.getRaw(indexVersionsName, &out); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// bumpIndexVersions gives the given shards a new version, must be called with the shard lock held.
+// The manifest is updated atomically so bumps made by other clients are kept.
+func (c *Client) bumpIndexVersions(keys ...string) error {
+	versions := make(map[string]indexVersion)
+	err := updateKey(c.store, indexVersionsName, &versions, func(found bool) (updateAction, error) {
+		if versions == nil {
+			versions = make(map[string]indexVersion)
+		}
+		for _, key := range keys {
+			versions[key] = indexVersion{Version: generateObjectUID(), Modified: c.clock.time()}
+		}
+		return updateSet, nil
+	})
+	return errors.WithStack(err)
+}
+
+// storedIndexObject returns the index of the stored object, nil if it doesn't exist.
+func (c *Client) storedIndexObject(uid string) (*types.IndexObject, error) {
+	o := &types.Object{}
+	if err := c.getRaw(objectPrefix+uid, o); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	return c.indexObject(o), nil
+}
+
+// SyncChanges reloads changed user groups and updates the local memory index with the index shards changed in the store since the last sync.
+func (c *Client) SyncChanges() error {
+	if err := c.loadUserGroups(); err != nil {
+		c.syncFailed()
+		return errors.WithStack(err)
+	}
+	versions, err := c.getIndexVersions()
+	if err != nil {
+		c.syncFailed()
+		return errors.WithStack(err)
+	}
+	c.indexSync.Lock()
+	loaded := c.shardVersions
+	c.indexSync.Unlock()
+	if len(versions) == 0 || loaded == nil {
+		// store written before shard versions existed, or never fully synced
+		return errors.WithStack(c.Sync())
+	}
+	changed := make([]string, 0)
+	commit := make([]string, 0)
+	shards := 0
+	for _, key := range indexShardKeys() {
+		if versions[key].Version == loaded[key] {
+			continue
+		}
+		shard, err := c.getIndexShard(key)
+		if err != nil {
+			c.syncFailed()
+			return errors.WithStack(err)
+		}
+		shards++
+		update := make([]*types.IndexObject, 0)
+		c.indexSync.Lock()
+		for uid, remoteIndexItem := range shard.Objects {
+			c.clock.observe(remoteIndexItem.HLC)
+			i, exists := c.indexMap[uid]
+			if !exists || newerIndexObject(remoteIndexItem, c.index[i]) {
+				update = append(update, remoteIndexItem)
+			}
+		}
+		// local items missing from the shard were deleted by another client or lost in a write race
+		for _, localIndexItem := range c.index {
+			if indexShardKey(localIndexItem.UID) == key && shard.Objects[localIndexItem.UID] == nil {
+				commit = append(commit, localIndexItem.UID)
+			}
+		}
+		c.shardVersions[key] = versions[key].Version
+		c.indexSync.Unlock()
+		for _, o := range update {
+			c.addIndex(o)
+			changed = append(changed, o.UID)
+		}
+	}
+	for _, uid := range commit {
+		if err := c.restoreIndexObject(uid); err != nil {
+			c.syncFailed()
+			return errors.WithStack(err)
+		}
+		changed = append(changed, uid)
+	}
+	if err := c.reindexSearch(changed); err != nil {
+		c.syncFailed()
+		return errors.WithStack(err)
+	}
+	c.syncDone(shards)
+	return nil
+}
+
+// restoreIndexObject sets the index entry of object from the stored object, removing it if the object doesn't exist.
+func (c *Client) restoreIndexObject(uid string) error {
+	indexObj, err := c.storedIndexObject(uid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if indexObj == nil {
+		c.deleteIndex(uid)
+		return nil
+	}
+	c.addIndex(indexObj)
+	return errors.WithStack(c.commitIndexObject(uid, indexObj))
+}
+
+func (c *Client) syncDone(shards int) {
+	c.syncStatusLock.Lock()
+	defer c.syncStatusLock.Unlock()
+	c.syncStatus.LastSync = time.Now()
+	c.syncStatus.Syncs++
+	c.syncStatus.Shards = shards
+}
+
+func (c *Client) syncFailed() {
+	c.syncStatusLock.Lock()
+	defer c.syncStatusLock.Unlock()
+	c.syncStatus.Errors++
+}
+
+// SyncStatus returns the state of index synchronization.
+func (c *Client) SyncStatus() SyncStatus {
+	c.syncStatusLock.Lock()
+	defer c.syncStatusLock.Unlock()
+	return c.syncStatus
+}
+
+// StartSync starts synchronizing the local memory index with the store in the background.
+func (c *Client) StartSync(config SyncConfig) {
+	if config.Interval <= 0 {
+		return
+	}
+	c.StopSync()
+	stop := make(chan struct{})
+	c.syncStatusLock.Lock()
+	c.syncStop = stop
+	c.syncStatusLock.Unlock()
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.Interval) * time.Millisecond)
+		defer ticker.Stop()
+		for tick := 1; ; tick++ {
+			select {
+			case <-stop:
+				{
+					return
+				}
+			case <-ticker.C:
+				{
+					var err error
+					if config.FullEvery > 0 && tick%config.FullEvery == 0 {
+						err = c.Sync()
+					} else {
+						err = c.SyncChanges()
+					}
+					if err != nil {
+						logWarnErr(err, "index sync error")
+					}
+					break
+				}
+			}
+		}
+	}()
+}
+
+// StopSync stops background synchronization.
+func (c *Client) StopSync() {
+	c.syncStatusLock.Lock()
+	defer c.syncStatusLock.Unlock()
+	if c.syncStop != nil {
+		close(c.syncStop)
+		c.syncStop = nil
+	}
+}
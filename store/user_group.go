@@ -1,25 +1,47 @@
 package store
 
 import (
-	"github.com/caibirdme/yql"
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
 	"gitlab.com/contextualcode/go-object-store/types"
 )
 
 const (
 	permGet    = "get"
+	permList   = "list" // get objects through queries, defaults to the get rule
 	permSet    = "set"
 	permUpdate = "update"
 	permDelete = "delete"
 )
 
+// permTypes are the permission types of user group rules.
+var permTypes = []string{permGet, permList, permSet, permUpdate, permDelete}
+
 // UserGroup defines access parameters for a user group.
 type UserGroup struct {
-	Get      interface{}          `yaml:"get"`    // read
-	Set      interface{}          `yaml:"set"`    // create new
-	Update   interface{}          `yaml:"update"` // update existing (that user is not author of)
-	Delete   interface{}          `yaml:"delete"` // delete
-	compiled map[string]yql.Ruler `yaml:"-"`
+	Get              interface{}            `yaml:"get" json:"get,omitempty"`                               // read
+	List             interface{}            `yaml:"list" json:"list,omitempty"`                             // query, defaults to the get rule
+	Set              interface{}            `yaml:"set" json:"set,omitempty"`                               // create new
+	Update           interface{}            `yaml:"update" json:"update,omitempty"`                         // update existing (that user is not author of)
+	Delete           interface{}            `yaml:"delete" json:"delete,omitempty"`                         // delete
+	SavedQueriesOnly bool                   `yaml:"saved_queries_only" json:"saved_queries_only,omitempty"` // only allow running saved queries, not raw queries
+	MaxResults       int                    `yaml:"max_results" json:"max_results,omitempty"`               // max number of objects a query may return, zero for no limit
+	MaxComplexity    int                    `yaml:"max_complexity" json:"max_complexity,omitempty"`         // max number of conditions in a query, zero for no limit
+	Timeout          int                    `yaml:"timeout_ms" json:"timeout_ms,omitempty"`                 // query execution timeout in milliseconds, zero for no limit
+	HiddenFields     []string               `yaml:"hidden_fields" json:"hidden_fields,omitempty"`           // data dot paths removed from objects read by the group
+	ReadOnlyFields   []string               `yaml:"read_only_fields" json:"read_only_fields,omitempty"`     // data dot paths the group can't write
+	ReadOnlyMode     string                 `yaml:"read_only_mode" json:"read_only_mode,omitempty"`         // 'reject' writes to read only fields (default) or 'ignore' them
+	Admin            bool                   `yaml:"admin" json:"admin,omitempty"`                           // admins can change the access control list of any object
+	RateLimit        int                    `yaml:"rate_limit" json:"rate_limit,omitempty"`                 // requests allowed per rate window, zero for no limit
+	RateWindow       int                    `yaml:"rate_window_ms" json:"rate_window_ms,omitempty"`         // rate limit window in milliseconds, defaults to an hour
+	MaxObjects       int                    `yaml:"max_objects" json:"max_objects,omitempty"`               // max number of objects a member may author, zero if not set
+	MaxBytes         int64                  `yaml:"max_bytes" json:"max_bytes,omitempty"`                   // max bytes of objects a member may author, zero if not set
+	Inherits         []string               `yaml:"inherits" json:"inherits,omitempty"`                     // groups whose permissions the group also has
+	Deny             map[string]interface{} `yaml:"deny" json:"deny,omitempty"`                             // rules by permission type that deny access over any allow rule
+	compiled         map[string]queryExpr   `yaml:"-" json:"-"`
+	compiledDeny     map[string]queryExpr   `yaml:"-" json:"-"`
 }
 
 func (g *UserGroup) getPerm(permType string) interface{} {
@@ -28,6 +50,13 @@ func (g *UserGroup) getPerm(permType string) interface{} {
 		{
 			return g.Get
 		}
+	case permList:
+		{
+			if g.List == nil {
+				return g.Get
+			}
+			return g.List
+		}
 	case permSet:
 		{
 			return g.Set
@@ -44,40 +73,97 @@ func (g *UserGroup) getPerm(permType string) interface{} {
 	return nil
 }
 
+// getDeny returns the deny rule of permission type, list defaults to the get rule.
+func (g *UserGroup) getDeny(permType string) interface{} {
+	if permType == permList && g.Deny[permList] == nil {
+		return g.Deny[permGet]
+	}
+	return g.Deny[permType]
+}
+
 func (g *UserGroup) compile() error {
-	g.compiled = make(map[string]yql.Ruler)
-	for _, permType := range []string{permGet, permSet, permUpdate, permDelete} {
-		perm := g.getPerm(permType)
+	g.compiled = make(map[string]queryExpr)
+	g.compiledDeny = make(map[string]queryExpr)
+	for _, permType := range permTypes {
 		var err error
-		switch v := perm.(type) {
-		case string:
-			{
-				g.compiled[permType], err = yql.Rule(v)
-				if err != nil {
-					return errors.WithStack(err)
-				}
-				break
-			}
+		if g.compiled[permType], err = compilePerm(g.getPerm(permType)); err != nil {
+			return errors.WithStack(err)
+		}
+		if g.compiledDeny[permType], err = compilePerm(g.getDeny(permType)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for permType := range g.Deny {
+		if !validPermType(permType) {
+			return errors.Wrapf(ErrInvalidArg, "invalid deny permission %s", permType)
 		}
 	}
 	return nil
 }
 
-func (g UserGroup) check(permType string, o *types.IndexObject) (bool, error) {
+// compilePerm parses a query string or filter document permission rule, other rules return nil.
+func compilePerm(perm interface{}) (queryExpr, error) {
+	switch v := perm.(type) {
+	case string:
+		{
+			expr, err := parseQuery(v)
+			return expr, errors.WithStack(err)
+		}
+	case map[string]interface{}, types.Filter:
+		{
+			filter, _ := filterMap(v)
+			expr, err := parseFilter(filter)
+			return expr, errors.WithStack(err)
+		}
+	}
+	return nil, nil
+}
+
+func validPermType(permType string) bool {
+	switch permType {
+	case permGet, permList, permSet, permUpdate, permDelete:
+		{
+			return true
+		}
+	}
+	return false
+}
+
+// check returns true if group permission allows user access to object, rules are
+// evaluated with the query variables of the user, i.e. '$user'.
+func (g UserGroup) check(permType string, o *types.IndexObject, variables map[string]interface{}) (bool, error) {
+	if o == nil {
+		return false, errors.WithStack(ErrMissingObject)
+	}
+	return g.matchPerm(permType, false, o, variables)
+}
+
+// denies returns true if a deny rule of group matches user access to object.
+func (g UserGroup) denies(permType string, o *types.IndexObject, variables map[string]interface{}) (bool, error) {
 	if o == nil {
 		return false, errors.WithStack(ErrMissingObject)
 	}
-	perm := g.getPerm(permType)
+	return g.matchPerm(permType, true, o, variables)
+}
+
+func (g UserGroup) matchPerm(permType string, deny bool, o *types.IndexObject, variables map[string]interface{}) (bool, error) {
+	perm, compiled := g.getPerm(permType), g.compiled
+	if deny {
+		perm, compiled = g.getDeny(permType), g.compiledDeny
+	}
 	switch perm := perm.(type) {
-	case string:
+	case string, map[string]interface{}, types.Filter:
 		{
-			if g.compiled[permType] == nil {
+			if compiled[permType] == nil {
 				if err := g.compile(); err != nil {
 					return false, errors.WithStack(err)
 				}
+				compiled = g.compiled
+				if deny {
+					compiled = g.compiledDeny
+				}
 			}
-			match, err := g.compiled[permType].Match(o.QueryMap())
-			return match, errors.WithStack(err)
+			return compiled[permType].match(queryData(o, variables)), nil
 		}
 	case bool:
 		{
@@ -92,20 +178,155 @@ func (g UserGroup) check(permType string, o *types.IndexObject) (bool, error) {
 
 // CanGet returns true if group permission allows reading given object.
 func (g UserGroup) CanGet(o *types.IndexObject) (bool, error) {
-	return g.check(permGet, o)
+	return g.check(permGet, o, nil)
+}
+
+// CanList returns true if group permission allows querying given object.
+func (g UserGroup) CanList(o *types.IndexObject) (bool, error) {
+	return g.check(permList, o, nil)
 }
 
 // CanSet returns true if group permission allow creation of given object.
 func (g UserGroup) CanSet(o *types.IndexObject) (bool, error) {
-	return g.check(permSet, o)
+	return g.check(permSet, o, nil)
 }
 
 // CanUpdate returns true if group permission allows updating the given object.
 func (g UserGroup) CanUpdate(o *types.IndexObject) (bool, error) {
-	return g.check(permUpdate, o)
+	return g.check(permUpdate, o, nil)
 }
 
 // CanDelete returns true if group permission allows deleting the given object.
 func (g UserGroup) CanDelete(o *types.IndexObject) (bool, error) {
-	return g.check(permDelete, o)
+	return g.check(permDelete, o, nil)
+}
+
+// userGroupNames returns names followed by the groups they inherit from, each group once.
+func userGroupNames(userGroups map[string]UserGroup, names []string) []string {
+	out := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		out = append(out, name)
+		for _, parent := range userGroups[name].Inherits {
+			add(parent)
+		}
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return out
+}
+
+// checkUserGroups returns an error for the first user group with invalid rules, an
+// unknown inherited group or an inheritance cycle.
+func checkUserGroups(userGroups map[string]UserGroup) error {
+	names := make([]string, 0, len(userGroups))
+	for name := range userGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		userGroup := userGroups[name]
+		if err := userGroup.compile(); err != nil {
+			return errors.Wrapf(err, "user group %s", name)
+		}
+		for _, parent := range userGroup.Inherits {
+			if _, exists := userGroups[parent]; !exists {
+				return errors.Wrapf(ErrInvalidArg, "user group %s inherits unknown group %s", name, parent)
+			}
+		}
+		if cycle := inheritanceCycle(userGroups, []string{name}); cycle != nil {
+			return errors.Wrapf(ErrInvalidArg, "user group inheritance cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// inheritanceCycle returns the path of groups back to a group already in path, nil if there's none.
+func inheritanceCycle(userGroups map[string]UserGroup, path []string) []string {
+	for _, parent := range userGroups[path[len(path)-1]].Inherits {
+		for _, name := range path {
+			if name == parent {
+				return append(append([]string{}, path...), parent)
+			}
+		}
+		if cycle := inheritanceCycle(userGroups, append(path, parent)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// CheckUserGroups returns an error if the configured user groups are invalid.
+func (c *Client) CheckUserGroups() error {
+	return errors.WithStack(checkUserGroups(c.getUserGroupMap()))
+}
+
+// GroupRule is a permission rule and the user group it's configured on.
+type GroupRule struct {
+	Group string
+	Rule  interface{}
+}
+
+// EffectiveUserGroup is the resolved permissions of a user group with those it inherits.
+type EffectiveUserGroup struct {
+	Name   string
+	Groups []string               // group followed by the groups it inherits
+	Allow  map[string][]GroupRule // allow rules by permission type, any one grants access
+	Deny   map[string][]GroupRule // deny rules by permission type, any one denies access
+}
+
+// API converts effective user group to API object.
+func (e *EffectiveUserGroup) API() types.APIObject {
+	rulesAPI := func(rules map[string][]GroupRule) map[string]interface{} {
+		out := make(map[string]interface{})
+		for permType, permRules := range rules {
+			list := make([]interface{}, 0, len(permRules))
+			for _, rule := range permRules {
+				list = append(list, map[string]interface{}{"group": rule.Group, "rule": rule.Rule})
+			}
+			out[permType] = list
+		}
+		return out
+	}
+	return types.APIObject{
+		"name":   e.Name,
+		"groups": e.Groups,
+		"allow":  rulesAPI(e.Allow),
+		"deny":   rulesAPI(e.Deny),
+	}
+}
+
+// EffectiveUserGroup returns the resolved permissions of the named user group.
+func (c *Client) EffectiveUserGroup(name string) (*EffectiveUserGroup, error) {
+	userGroups := c.getUserGroupMap()
+	if _, exists := userGroups[name]; !exists {
+		return nil, errors.Wrapf(ErrNotFound, "user group %s", name)
+	}
+	if err := checkUserGroups(userGroups); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out := &EffectiveUserGroup{
+		Name:   name,
+		Groups: userGroupNames(userGroups, []string{name}),
+		Allow:  make(map[string][]GroupRule),
+		Deny:   make(map[string][]GroupRule),
+	}
+	for _, groupName := range out.Groups {
+		userGroup := userGroups[groupName]
+		for _, permType := range permTypes {
+			if perm := userGroup.getPerm(permType); perm != nil && perm != false {
+				out.Allow[permType] = append(out.Allow[permType], GroupRule{Group: groupName, Rule: perm})
+			}
+			if perm := userGroup.getDeny(permType); perm != nil && perm != false {
+				out.Deny[permType] = append(out.Deny[permType], GroupRule{Group: groupName, Rule: perm})
+			}
+		}
+	}
+	return out, nil
 }
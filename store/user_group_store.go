@@ -0,0 +1,221 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+// userGroupsKey is the key of the user groups managed in the store.
+const userGroupsKey = "groups_store"
+
+// storedUserGroups are the user groups managed in the store, the version changes on every write
+// so other clients know to reload them.
+type storedUserGroups struct {
+	Version string               `json:"version"`
+	Groups  map[string]UserGroup `json:"groups"`
+}
+
+// NamedUserGroup is a user group with its name.
+type NamedUserGroup struct {
+	Name   string
+	Config bool // defined in the config, these can't be changed at runtime
+	UserGroup
+}
+
+// API converts named user group to API object.
+func (g NamedUserGroup) API() types.APIObject {
+	out := make(types.APIObject)
+	raw, _ := json.Marshal(g.UserGroup)
+	json.Unmarshal(raw, &out)
+	out["name"] = g.Name
+	out["config"] = g.Config
+	return out
+}
+
+// ParseUserGroup converts API object to named user group.
+func ParseUserGroup(o types.APIObject) (NamedUserGroup, error) {
+	out := NamedUserGroup{}
+	out.Name, _ = o["name"].(string)
+	if out.Name == "" {
+		return out, errors.Wrap(ErrInvalidArg, "user group must have a name")
+	}
+	data := make(map[string]interface{}, len(o))
+	for k, v := range o {
+		if k != "name" && k != "config" {
+			data[k] = v
+		}
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return out, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(raw, &out.UserGroup); err != nil {
+		return out, errors.Wrapf(ErrInvalidArg, "user group %s: %s", out.Name, err)
+	}
+	return out, nil
+}
+
+// getUserGroupMap returns the current user groups by name, the map must not be modified.
+func (c *Client) getUserGroupMap() map[string]UserGroup {
+	c.userGroupsLock.RLock()
+	defer c.userGroupsLock.RUnlock()
+	return c.userGroups
+}
+
+// IsAdmin returns true if user belongs to an admin group, a nil user is trusted.
+func (c *Client) IsAdmin(u *types.User) bool {
+	if u == nil {
+		return true
+	}
+	for _, userGroup := range c.getUserGroups(u) {
+		if userGroup.Admin {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) getStoredUserGroups() (storedUserGroups, error) {
+	out := storedUserGroups{}
+	if err := c.getRaw(userGroupsKey, &out); err != nil && !errors.Is(err, ErrNotFound) {
+		return out, errors.WithStack(err)
+	}
+	if out.Groups == nil {
+		out.Groups = make(map[string]UserGroup)
+	}
+	return out, nil
+}
+
+// mergeUserGroups returns the configured user groups with the stored ones, configured groups can't be replaced.
+func (c *Client) mergeUserGroups(stored map[string]UserGroup) map[string]UserGroup {
+	out := make(map[string]UserGroup, len(c.configUserGroups)+len(stored))
+	for name, userGroup := range stored {
+		if _, exists := c.configUserGroups[name]; exists {
+			logWarn(fmt.Sprintf("stored user group %s is ignored, it's defined in the config", name))
+			continue
+		}
+		if err := userGroup.compile(); err != nil {
+			logWarnErr(err, fmt.Sprintf("user group %s is invalid", name))
+		}
+		out[name] = userGroup
+	}
+	for name, userGroup := range c.configUserGroups {
+		out[name] = userGroup
+	}
+	return out
+}
+
+// loadUserGroups reloads the user groups managed in the store when they changed since the last load.
+func (c *Client) loadUserGroups() error {
+	stored, err := c.getStoredUserGroups()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.userGroupsLock.Lock()
+	defer c.userGroupsLock.Unlock()
+	if stored.Version == c.userGroupsVersion {
+		return nil
+	}
+	c.userGroups = c.mergeUserGroups(stored.Groups)
+	c.userGroupsVersion = stored.Version
+	if err := checkUserGroups(c.userGroups); err != nil {
+		logWarnErr(err, "user groups are invalid")
+	}
+	return nil
+}
+
+// LoadUserGroups loads the user groups managed in the store, clients created for a single
+// command call it so they see the stored groups and write over their current version.
+func (c *Client) LoadUserGroups() error {
+	return errors.WithStack(c.loadUserGroups())
+}
+
+// writeUserGroups applies change to the stored user groups, it's rejected if the result is invalid.
+// The write only succeeds if the stored groups are still the version this client last loaded,
+// otherwise the groups are reloaded and a conflict error is returned so the change can be retried.
+func (c *Client) writeUserGroups(change func(groups map[string]UserGroup) error) error {
+	c.userGroupsLock.Lock()
+	stored := storedUserGroups{}
+	var merged map[string]UserGroup
+	err := updateKey(c.store, userGroupsKey, &stored, func(found bool) (updateAction, error) {
+		if stored.Version != c.userGroupsVersion {
+			return updateSkip, errors.Wrapf(ErrConflict, "user groups are at version %s, not %s", stored.Version, c.userGroupsVersion)
+		}
+		if stored.Groups == nil {
+			stored.Groups = make(map[string]UserGroup)
+		}
+		if err := change(stored.Groups); err != nil {
+			return updateSkip, errors.WithStack(err)
+		}
+		merged = c.mergeUserGroups(stored.Groups)
+		if err := checkUserGroups(merged); err != nil {
+			return updateSkip, errors.WithStack(err)
+		}
+		stored.Version = c.clock.stamp().String()
+		return updateSet, nil
+	})
+	if err == nil {
+		c.userGroups = merged
+		c.userGroupsVersion = stored.Version
+	}
+	c.userGroupsLock.Unlock()
+	if errors.Is(err, ErrConflict) {
+		if loadErr := c.loadUserGroups(); loadErr != nil {
+			return errors.WithStack(loadErr)
+		}
+	}
+	return errors.WithStack(err)
+}
+
+// UserGroups returns the configured and stored user groups sorted by name, only admins can list them.
+func (c *Client) UserGroups(u *types.User) ([]NamedUserGroup, error) {
+	if !c.IsAdmin(u) {
+		return nil, errors.WithStack(ErrPermission)
+	}
+	userGroups := c.getUserGroupMap()
+	out := make([]NamedUserGroup, 0, len(userGroups))
+	for name, userGroup := range userGroups {
+		_, config := c.configUserGroups[name]
+		out = append(out, NamedUserGroup{Name: name, Config: config, UserGroup: userGroup})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// SetUserGroup creates or replaces a user group managed in the store, only admins can change them.
+func (c *Client) SetUserGroup(name string, userGroup UserGroup, u *types.User) error {
+	if !c.IsAdmin(u) {
+		return errors.WithStack(ErrPermission)
+	}
+	if name == "" {
+		return errors.Wrap(ErrInvalidArg, "user group must have a name")
+	}
+	if _, exists := c.configUserGroups[name]; exists {
+		return errors.Wrapf(ErrPermission, "user group %s is defined in the config", name)
+	}
+	return errors.WithStack(c.writeUserGroups(func(groups map[string]UserGroup) error {
+		groups[name] = userGroup
+		return nil
+	}))
+}
+
+// DeleteUserGroup deletes a user group managed in the store, only admins can change them.
+func (c *Client) DeleteUserGroup(name string, u *types.User) error {
+	if !c.IsAdmin(u) {
+		return errors.WithStack(ErrPermission)
+	}
+	if _, exists := c.configUserGroups[name]; exists {
+		return errors.Wrapf(ErrPermission, "user group %s is defined in the config", name)
+	}
+	return errors.WithStack(c.writeUserGroups(func(groups map[string]UserGroup) error {
+		if _, exists := groups[name]; !exists {
+			return errors.Wrapf(ErrNotFound, "user group %s", name)
+		}
+		delete(groups, name)
+		return nil
+	}))
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestStoredUserGroups(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"staff": {Get: true},
+			"admin": {Admin: true},
+		},
+	})
+	client2 := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"staff": {Get: true},
+			"admin": {Admin: true},
+		},
+	})
+	client2.store = client.store
+	staff := &types.User{UID: "staff", Groups: []string{"staff"}}
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	admin := &types.User{UID: "admin", Groups: []string{"admin"}}
+	o := &types.Object{Data: map[string]interface{}{"type": "page"}}
+	if err := client.Set(o, nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// only admins can manage groups and configured groups are immutable
+	editors := UserGroup{Inherits: []string{"staff"}, Update: "type = 'page'"}
+	if err := client.SetUserGroup("editor", editors, staff); !errors.Is(err, ErrPermission) {
+		t.Error("expected permission error")
+	}
+	if err := client.SetUserGroup("staff", UserGroup{Get: false}, admin); !errors.Is(err, ErrPermission) {
+		t.Error("expected configured group to be immutable")
+	}
+	if err := client.SetUserGroup("loop", UserGroup{Inherits: []string{"loop"}}, admin); !errors.Is(err, ErrInvalidArg) {
+		t.Error("expected inheritance cycle error")
+	}
+	if err := client.SetUserGroup("editor", editors, admin); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := client.Set(o, editor); err != nil {
+		t.Error(err)
+	}
+	if err := client.DeleteUserGroup("staff", admin); !errors.Is(err, ErrPermission) {
+		t.Error("expected configured group to be immutable")
+	}
+
+	// other clients pick up the change on sync
+	if err := client2.Set(o, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected unknown group before sync")
+	}
+	if err := client2.SyncChanges(); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := client2.Set(o, editor); err != nil {
+		t.Error(err)
+	}
+	if err := client2.DeleteUserGroup("editor", admin); err != nil {
+		t.Error(err)
+	}
+	client.SyncChanges()
+	if _, err := client.Get(o.UID, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected deleted group to be removed on sync")
+	}
+	userGroups, err := client.UserGroups(admin)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(userGroups) != 2 || !userGroups[0].Config || userGroups[0].Name != "admin" {
+		t.Errorf("unexpected user groups %+v", userGroups)
+	}
+
+	// writes over groups changed by another client since the last load conflict
+	if err := client.SetUserGroup("writer", UserGroup{Set: true}, admin); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := client2.SetUserGroup("reviewer", UserGroup{Get: true}, admin); !errors.Is(err, ErrConflict) {
+		t.Error("expected conflict error")
+		return
+	}
+	if err := client2.SetUserGroup("reviewer", UserGroup{Get: true}, admin); err != nil {
+		t.Error(err)
+		return
+	}
+	client.SyncChanges()
+	userGroups, _ = client.UserGroups(admin)
+	if len(userGroups) != 4 {
+		t.Errorf("expected both written groups, got %+v", userGroups)
+	}
+}
+
+func TestStoredUserGroupsFsck(t *testing.T) {
+	client := NewClient(nil)
+	if err := client.SetUserGroup("editor", UserGroup{Get: true}, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	// stored groups aren't mistaken for a user record
+	issues, err := client.Fsck(false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(issues) != 0 {
+		t.Errorf("unexpected fsck issues %+v", issues)
+	}
+	if _, err := client.GetUser("groups"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected no user for the stored groups key")
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/contextualcode/go-object-store/types"
+)
+
+func TestUserGroupInherits(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"staff": {Get: true, Set: true, Update: true, Delete: true},
+			"editor": {
+				Inherits: []string{"staff"},
+				Deny:     map[string]interface{}{permDelete: "type = 'invoice'"},
+			},
+			"intern": {Inherits: []string{"editor"}, Deny: map[string]interface{}{permGet: true}},
+		},
+	})
+	staff := &types.User{UID: "staff", Groups: []string{"staff"}}
+	editor := &types.User{UID: "editor", Groups: []string{"editor"}}
+	intern := &types.User{UID: "intern", Groups: []string{"intern"}}
+	invoice := &types.Object{Data: map[string]interface{}{"type": "invoice"}}
+	page := &types.Object{Data: map[string]interface{}{"type": "page"}}
+	for _, o := range []*types.Object{invoice, page} {
+		if err := client.Set(o, editor); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := client.Get(invoice.UID, editor); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Get(page.UID, intern); !errors.Is(err, ErrPermission) {
+		t.Error("expected deny rule to take precedence")
+	}
+	if err := client.Delete(invoice, editor); !errors.Is(err, ErrPermission) {
+		t.Error("expected delete of invoice to be denied")
+	}
+	if err := client.Delete(page, editor); err != nil {
+		t.Error(err)
+	}
+	if err := client.Delete(invoice, staff); err != nil {
+		t.Error(err)
+	}
+
+	// effective permissions
+	group, err := client.EffectiveUserGroup("intern")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(group.Groups) != 3 || group.Groups[2] != "staff" {
+		t.Errorf("unexpected groups %v", group.Groups)
+	}
+	if len(group.Allow[permDelete]) != 1 || len(group.Deny[permDelete]) != 1 || len(group.Deny[permGet]) != 1 {
+		t.Error("unexpected effective rules")
+	}
+
+	// cycles
+	client.userGroups["staff"] = UserGroup{Inherits: []string{"intern"}}
+	if err := client.CheckUserGroups(); !errors.Is(err, ErrInvalidArg) {
+		t.Error("expected inheritance cycle error")
+	}
+	o := &types.Object{Data: map[string]interface{}{"type": "page"}}
+	if err := client.Set(o, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := client.Get(o.UID, staff); !errors.Is(err, ErrPermission) {
+		t.Error("expected cyclic groups to resolve")
+	}
+}
+
+func TestUserGroupList(t *testing.T) {
+	client := NewClient(&Config{
+		UserGroups: map[string]UserGroup{
+			"reader": {Get: true, List: "public = true", Deny: map[string]interface{}{permGet: "hidden = true"}},
+			"staff":  {Get: true},
+			"admin":  {Admin: true},
+		},
+	})
+	reader := &types.User{UID: "reader", Groups: []string{"reader"}}
+	staff := &types.User{UID: "staff", Groups: []string{"staff"}}
+	admin := &types.User{UID: "admin", Groups: []string{"admin"}}
+	objs := []*types.Object{
+		{Data: map[string]interface{}{"type": "doc", "public": true}},
+		{Data: map[string]interface{}{"type": "doc", "public": false}},
+		{Data: map[string]interface{}{"type": "doc", "public": true, "hidden": true}},
+	}
+	for _, o := range objs {
+		if err := client.Set(o, nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// objects can be fetched by uid without being enumerable
+	if _, err := client.Get(objs[1].UID, reader); err != nil {
+		t.Error(err)
+	}
+	res, err := client.Query("type = 'doc'", reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 1 || res[0].UID != objs[0].UID {
+		t.Errorf("expected only public objects to be listed, got %d", len(res))
+	}
+	// list defaults to the get rule
+	if res, _ := client.Query("type = 'doc'", staff); len(res) != 3 {
+		t.Errorf("expected get rule to allow listing, got %d", len(res))
+	}
+	explain, err := client.ExplainPermission(permList, objs[1].UID, reader, admin)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if explain.Allowed || explain.Steps[len(explain.Steps)-2].Rule != "public = true" {
+		t.Errorf("unexpected steps %+v", explain.Steps)
+	}
+	explain, _ = client.ExplainPermission(permList, objs[2].UID, reader, admin)
+	if explain.Allowed || explain.Steps[0].Check != permStepDeny {
+		t.Errorf("expected get deny rule to apply to list, got %+v", explain.Steps)
+	}
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	// ACLUserPrefix prefixes the uid of a user in an access control list principal.
+	ACLUserPrefix = "user:"
+	// ACLGroupPrefix prefixes the name of a user group in an access control list principal.
+	ACLGroupPrefix = "group:"
+)
+
+// ACLEntry grants permissions on an object to a user or a user group.
+type ACLEntry struct {
+	Principal   string   `json:"principal"`   // 'user:<uid>' or 'group:<name>'
+	Permissions []string `json:"permissions"` // get, update or delete
+}
+
+// Matches returns true if entry applies to user.
+func (e ACLEntry) Matches(u *User) bool {
+	if u == nil {
+		return false
+	}
+	if strings.HasPrefix(e.Principal, ACLUserPrefix) {
+		return u.UID != "" && strings.TrimPrefix(e.Principal, ACLUserPrefix) == u.UID
+	}
+	for _, group := range u.Groups {
+		if e.Principal == ACLGroupPrefix+group {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants returns true if entry grants permission to user.
+func (e ACLEntry) Grants(u *User, perm string) bool {
+	if !e.Matches(u) {
+		return false
+	}
+	for _, p := range e.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseACL converts an API access control list value to its entries.
+func ParseACL(v interface{}) ([]ACLEntry, bool) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	out := make([]ACLEntry, 0)
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func aclAPI(acl []ACLEntry) []interface{} {
+	out := make([]interface{}, 0, len(acl))
+	for _, e := range acl {
+		perms := make([]interface{}, 0, len(e.Permissions))
+		for _, p := range e.Permissions {
+			perms = append(perms, p)
+		}
+		out = append(out, map[string]interface{}{"principal": e.Principal, "permissions": perms})
+	}
+	return out
+}
@@ -2,12 +2,23 @@ package types
 
 // APIRequest defines an API request.
 type APIRequest struct {
-	IP         string      `json:"-"`
-	SessionKey string      `json:"key,omitempty"`
-	Username   string      `json:"username,omitempty"`
-	Password   string      `json:"password,omitempty"`
-	Objects    []APIObject `json:"objects,omitempty"`
-	Query      string      `json:"query,omitempty"`
+	IP          string                 `json:"-"`
+	SessionKey  string                 `json:"key,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	Password    string                 `json:"password,omitempty"`
+	Objects     []APIObject            `json:"objects,omitempty"`
+	Query       string                 `json:"query,omitempty"`
+	Filter      Filter                 `json:"filter,omitempty"`
+	Name        string                 `json:"name,omitempty"`   // saved query name
+	Params      map[string]interface{} `json:"params,omitempty"` // saved query parameters
+	Text        string                 `json:"text,omitempty"`
+	GroupBy     []string               `json:"group_by,omitempty"`
+	Aggregates  []string               `json:"aggregates,omitempty"`
+	Principal   string                 `json:"principal,omitempty"`   // user or group to share objects with
+	Permissions []string               `json:"permissions,omitempty"` // permissions to grant, none to unshare
+	User        string                 `json:"user,omitempty"`        // username or uid of user to check permission or usage of
+	Action      string                 `json:"action,omitempty"`      // permission to check, get, list, set, update or delete
+	QueryOptions
 }
 
 // ObjectUIDs return list of object uids in api request.
@@ -14,6 +14,24 @@ const (
 	APIDelete APIResource = 4
 	// APIQuery defines query object action.
 	APIQuery APIResource = 5
+	// APIAggregate defines aggregate query action.
+	APIAggregate APIResource = 6
+	// APISearch defines full-text search action.
+	APISearch APIResource = 7
+	// APISavedQuery defines saved query action.
+	APISavedQuery APIResource = 8
+	// APIShare defines share object action.
+	APIShare APIResource = 9
+	// APIUserGroups defines list user groups action.
+	APIUserGroups APIResource = 10
+	// APIUserGroupSet defines set user group action.
+	APIUserGroupSet APIResource = 11
+	// APIUserGroupDelete defines delete user group action.
+	APIUserGroupDelete APIResource = 12
+	// APIPermissionCheck defines explain permission check action.
+	APIPermissionCheck APIResource = 13
+	// APIUsage defines storage usage action.
+	APIUsage APIResource = 14
 )
 
 // Name returns string name for API resource.
@@ -39,6 +57,42 @@ func (r APIResource) Name() string {
 		{
 			return "QUERY"
 		}
+	case APIAggregate:
+		{
+			return "AGGREGATE"
+		}
+	case APISearch:
+		{
+			return "SEARCH"
+		}
+	case APISavedQuery:
+		{
+			return "SAVED_QUERY"
+		}
+	case APIShare:
+		{
+			return "SHARE"
+		}
+	case APIUserGroups:
+		{
+			return "USER_GROUPS"
+		}
+	case APIUserGroupSet:
+		{
+			return "USER_GROUP_SET"
+		}
+	case APIUserGroupDelete:
+		{
+			return "USER_GROUP_DELETE"
+		}
+	case APIPermissionCheck:
+		{
+			return "PERMISSION_CHECK"
+		}
+	case APIUsage:
+		{
+			return "USAGE"
+		}
 	}
 	return ""
 }
@@ -7,4 +7,7 @@ type APIResponse struct {
 	Key     string      `json:"key,omitempty"`     // session key
 	Expires string      `json:"expires,omitempty"` // key expiration time
 	Objects []APIObject `json:"objects,omitempty"` // list of objects returned by the request
+	Cursor  string      `json:"cursor,omitempty"`  // cursor of the next page of query results
+	Total   *int        `json:"total,omitempty"`   // total number of query matches
+	Explain APIObject   `json:"explain,omitempty"` // how the query was evaluated
 }
@@ -0,0 +1,5 @@
+package types
+
+// Filter is a structured query document, an alternative to query strings, i.e.
+// {"type": "page", "views": {"$gt": 10}, "$or": [...]}.
+type Filter map[string]interface{}
@@ -0,0 +1,59 @@
+package types
+
+import "math"
+
+// earthRadiusKm is the mean radius of the earth.
+const earthRadiusKm = 6371.0088
+
+// GeoPoint is a latitude/longitude coordinate in degrees. Object data maps with numeric
+// 'lat' and 'lng' (or 'lon') keys are indexed as geo points.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// ParseGeoPoint returns value as a geo point if it's a map with valid coordinates.
+func ParseGeoPoint(v interface{}) (GeoPoint, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return GeoPoint{}, false
+	}
+	lngValue, exists := m["lng"]
+	if !exists {
+		lngValue = m["lon"]
+	}
+	lat, latOk := geoCoordinate(m["lat"])
+	lng, lngOk := geoCoordinate(lngValue)
+	if !latOk || !lngOk || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return GeoPoint{}, false
+	}
+	return GeoPoint{Lat: lat, Lng: lng}, true
+}
+
+func geoCoordinate(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		{
+			return float64(v), true
+		}
+	case float64:
+		{
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// DistanceKm returns the great-circle distance between two points in kilometers.
+func (p GeoPoint) DistanceKm(o GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, o.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (o.Lng - p.Lng) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Map returns geo point as index data.
+func (p GeoPoint) Map() map[string]interface{} {
+	return map[string]interface{}{"lat": p.Lat, "lng": p.Lng}
+}
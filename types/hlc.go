@@ -0,0 +1,49 @@
+package types
+
+import "fmt"
+
+// HLC is a hybrid logical clock timestamp. It follows wall clock time but never goes
+// backwards, so writes are ordered even when the clocks of hosts disagree.
+type HLC struct {
+	Wall    int64  `json:"wall"`    // physical time in unix nanoseconds
+	Logical uint32 `json:"logical"` // counter of events within the same physical time
+	Node    string `json:"node"`    // id of the clock that issued the timestamp, breaks ties
+}
+
+// IsZero returns true if timestamp wasn't set.
+func (h HLC) IsZero() bool {
+	return h.Wall == 0 && h.Logical == 0
+}
+
+// Compare returns -1, 0 or 1 if timestamp is before, equal to or after other.
+func (h HLC) Compare(other HLC) int {
+	switch {
+	case h.Wall != other.Wall:
+		{
+			if h.Wall < other.Wall {
+				return -1
+			}
+			return 1
+		}
+	case h.Logical != other.Logical:
+		{
+			if h.Logical < other.Logical {
+				return -1
+			}
+			return 1
+		}
+	case h.Node != other.Node:
+		{
+			if h.Node < other.Node {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// String returns timestamp as a string that sorts in timestamp order.
+func (h HLC) String() string {
+	return fmt.Sprintf("%016x.%08x.%s", h.Wall, h.Logical, h.Node)
+}
@@ -1,12 +1,31 @@
 package types
 
 import (
+	"path"
+	"strings"
 	"time"
 )
 
 // IndexValueMaxSize is the max length a value can be indexed.
 const IndexValueMaxSize = 128
 
+// dateFormats are the formats date strings are parsed from.
+var dateFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseDate parses a date string in RFC3339 or 'YYYY-MM-DD' format.
+func ParseDate(s string) (time.Time, bool) {
+	// quick check to avoid parsing strings that can't be dates
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return time.Time{}, false
+	}
+	for _, format := range dateFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // Object defines a storable object.
 type Object struct {
 	UID      string                 `json:"uid"`
@@ -14,56 +33,171 @@ type Object struct {
 	Modifier string                 `json:"modifier"`
 	Created  time.Time              `json:"created"`
 	Modified time.Time              `json:"modified"`
+	HLC      HLC                    `json:"hlc"`           // hybrid logical clock timestamp of the last write
+	ACL      []ACLEntry             `json:"acl,omitempty"` // access granted to specific users and groups, nil keeps the stored list on write
 	Data     map[string]interface{} `json:"data"`
 }
 
-// Index returns version of object with large data sets removed. Used to index for queries.
-func (o *Object) Index() *IndexObject {
-	indexData := make(map[string]interface{})
-	for k, v := range o.Data {
-		if len(k) > IndexValueMaxSize {
+// IndexConfig defines which data paths of an object are indexed.
+type IndexConfig struct {
+	Paths     []string `yaml:"paths"`      // dot paths to index, '*' matches a single path segment, every path when empty
+	MaxLength int      `yaml:"max_length"` // max length of indexed strings, defaults to IndexValueMaxSize
+	Dates     []string `yaml:"dates"`      // dot paths holding dates, indexed as RFC3339 UTC strings
+}
+
+// includes returns true if data path should be indexed.
+func (c IndexConfig) includes(p string) bool {
+	return len(c.Paths) == 0 || matchPaths(c.Paths, p)
+}
+
+// matchPaths returns true if data path matches any of the path patterns.
+func matchPaths(patterns []string, p string) bool {
+	segments := strings.Split(p, ".")
+	for _, pattern := range patterns {
+		// a pattern matches its path and every path nested below it
+		patternSegments := strings.Split(pattern, ".")
+		if len(patternSegments) > len(segments) {
 			continue
 		}
-		switch v := v.(type) {
-		case string:
-			{
-				indexData[k] = v
-				if len(v) > IndexValueMaxSize {
-					indexData[k] = v[0:IndexValueMaxSize]
-				}
-				break
-			}
-		case bool:
-			{
-				indexData[k] = v
-				break
-			}
-		case int:
-			{
-				indexData[k] = float64(v)
-				break
-			}
-		case float32:
-			{
-				indexData[k] = float64(v)
-				break
-			}
-		case float64:
-			{
-				indexData[k] = v
+		matched := true
+		for i, patternSegment := range patternSegments {
+			if ok, _ := path.Match(patternSegment, segments[i]); !ok {
+				matched = false
 				break
 			}
 		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Index returns version of object with large data sets removed. Used to index for queries.
+func (o *Object) Index() *IndexObject {
+	return o.IndexWithConfig(IndexConfig{})
+}
+
+// IndexWithConfig returns version of object with large data sets removed. Nested maps are
+// flattened in to dot paths and arrays are indexed as lists of their values.
+func (o *Object) IndexWithConfig(config IndexConfig) *IndexObject {
+	if config.MaxLength <= 0 {
+		config.MaxLength = IndexValueMaxSize
+	}
+	indexData := make(map[string]interface{})
+	for k, v := range o.Data {
+		indexValue(indexData, config, k, v, false)
 	}
 	return &IndexObject{
 		UID:      o.UID,
 		Author:   o.Author,
 		Created:  o.Created,
+		Modifier: o.Modifier,
 		Modified: o.Modified,
+		HLC:      o.HLC,
+		ACL:      o.ACL,
 		Data:     indexData,
 	}
 }
 
+// indexValue adds value at data path p to index data. Values inside arrays are
+// appended to a list at their path.
+func indexValue(indexData map[string]interface{}, config IndexConfig, p string, v interface{}, inArray bool) {
+	if len(p) > IndexValueMaxSize {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		{
+			// geo points are indexed as a whole as well as by their coordinates
+			if point, ok := ParseGeoPoint(v); ok && !inArray && config.includes(p) {
+				indexData[p] = point.Map()
+			}
+			for k, child := range v {
+				indexValue(indexData, config, p+"."+k, child, inArray)
+			}
+			return
+		}
+	case []interface{}:
+		{
+			for _, child := range v {
+				indexValue(indexData, config, p, child, true)
+			}
+			// keep empty arrays so they can be counted
+			if _, exists := indexData[p]; !exists && len(v) == 0 && config.includes(p) {
+				indexData[p] = []interface{}{}
+			}
+			return
+		}
+	case []string:
+		{
+			values := make([]interface{}, 0, len(v))
+			for _, child := range v {
+				values = append(values, child)
+			}
+			indexValue(indexData, config, p, values, inArray)
+			return
+		}
+	}
+	if !config.includes(p) {
+		return
+	}
+	if len(config.Dates) > 0 && matchPaths(config.Dates, p) {
+		v = indexDate(v)
+	}
+	var value interface{}
+	switch v := v.(type) {
+	case time.Time:
+		{
+			value = v.UTC().Format(time.RFC3339Nano)
+			break
+		}
+	case string:
+		{
+			value = v
+			if len(v) > config.MaxLength {
+				value = v[0:config.MaxLength]
+			}
+			break
+		}
+	case bool:
+		{
+			value = v
+			break
+		}
+	case int:
+		{
+			value = float64(v)
+			break
+		}
+	case int64:
+		{
+			value = float64(v)
+			break
+		}
+	case float32:
+		{
+			value = float64(v)
+			break
+		}
+	case float64:
+		{
+			value = v
+			break
+		}
+	default:
+		{
+			return
+		}
+	}
+	if !inArray {
+		indexData[p] = value
+		return
+	}
+	values, _ := indexData[p].([]interface{})
+	indexData[p] = append(values, value)
+}
+
 // API converts object to API object.
 func (o *Object) API() APIObject {
 	out := make(APIObject)
@@ -72,8 +206,40 @@ func (o *Object) API() APIObject {
 	out["_modifier"] = o.Modifier
 	out["_created"] = o.Created.Format(time.RFC3339)
 	out["_modified"] = o.Modified.Format(time.RFC3339)
+	if !o.HLC.IsZero() {
+		out["_hlc"] = o.HLC.String()
+	}
+	if o.ACL != nil {
+		out["_acl"] = aclAPI(o.ACL)
+	}
 	for k, v := range o.Data {
 		out[k] = v
 	}
 	return out
 }
+
+// indexDate converts a date string or unix timestamp to a time, other values are returned unchanged.
+func indexDate(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		{
+			if t, ok := ParseDate(v); ok {
+				return t
+			}
+			break
+		}
+	case int:
+		{
+			return time.Unix(int64(v), 0)
+		}
+	case int64:
+		{
+			return time.Unix(v, 0)
+		}
+	case float64:
+		{
+			return time.Unix(int64(v), 0)
+		}
+	}
+	return v
+}
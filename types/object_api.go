@@ -14,10 +14,14 @@ func (o *APIObject) UID() string {
 // Object returns object from API object data.
 func (o *APIObject) Object() *Object {
 	uid := (*o)["_uid"]
+	var acl []ACLEntry
+	if v, exists := (*o)["_acl"]; exists {
+		acl, _ = ParseACL(v)
+	}
 	data := make(map[string]interface{})
 	for k, v := range *o {
 		switch k {
-		case "_uid", "_created", "_author", "_modified", "_modifier":
+		case "_uid", "_created", "_author", "_modified", "_modifier", "_hlc", "_acl", "_score", "_distance":
 			{
 				break
 			}
@@ -33,6 +37,7 @@ func (o *APIObject) Object() *Object {
 	}
 	return &Object{
 		UID:  uid.(string),
+		ACL:  acl,
 		Data: data,
 	}
 }
@@ -9,6 +9,8 @@ type IndexObject struct {
 	Modifier string                 `json:"modifier"`
 	Created  time.Time              `json:"created"`
 	Modified time.Time              `json:"modified"`
+	HLC      HLC                    `json:"hlc"`
+	ACL      []ACLEntry             `json:"acl,omitempty"`
 	Data     map[string]interface{} `json:"data"`
 }
 
@@ -19,6 +21,9 @@ func (i *IndexObject) QueryMap() map[string]interface{} {
 	out["_modified"] = i.Modified.UTC().Unix()
 	out["_author"] = i.Author
 	out["_modifier"] = i.Modified
+	if !i.HLC.IsZero() {
+		out["_hlc"] = i.HLC.String()
+	}
 	for k, v := range i.Data {
 		out[k] = v
 	}
@@ -33,6 +38,12 @@ func (i *IndexObject) API() APIObject {
 	out["_modifier"] = i.Modifier
 	out["_created"] = i.Created.Format(time.RFC3339)
 	out["_modified"] = i.Modified.Format(time.RFC3339)
+	if !i.HLC.IsZero() {
+		out["_hlc"] = i.HLC.String()
+	}
+	if i.ACL != nil {
+		out["_acl"] = aclAPI(i.ACL)
+	}
 	for k, v := range i.Data {
 		out[k] = v
 	}
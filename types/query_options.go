@@ -0,0 +1,12 @@
+package types
+
+// QueryOptions defines options that order and paginate query results.
+type QueryOptions struct {
+	Sort    []string `json:"sort,omitempty"`    // fields to order by, prefix field with '-' for descending order
+	Limit   int      `json:"limit,omitempty"`   // max number of objects to return, zero for no limit
+	Cursor  string   `json:"cursor,omitempty"`  // cursor of the page to return
+	Total   bool     `json:"total,omitempty"`   // include the total number of matches
+	Full    bool     `json:"full,omitempty"`    // return full stored objects instead of index objects
+	Fields  []string `json:"fields,omitempty"`  // only return these fields of each object
+	Explain bool     `json:"explain,omitempty"` // describe how the query was evaluated
+}
@@ -13,6 +13,8 @@ type User struct {
 	Modified     time.Time `json:"modified"`
 	Active       bool      `json:"active"`
 	Groups       []string  `json:"groups"`
+	// Attributes are custom user values permission rules and queries can refer to as '$user.<name>'
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 // API converts user to API object.
@@ -22,6 +24,9 @@ func (u *User) API() APIObject {
 	out["_username"] = u.Username
 	out["_active"] = u.Active
 	out["_groups"] = u.Groups
+	if u.Attributes != nil {
+		out["_attributes"] = u.Attributes
+	}
 	out["_created"] = u.Created.Format(time.RFC3339)
 	out["_modified"] = u.Modified.Format(time.RFC3339)
 	return out